@@ -14,6 +14,7 @@ require (
 	go.uber.org/multierr v1.9.0
 	golang.org/x/mod v0.14.0
 	golang.org/x/text v0.14.0
+	golang.org/x/tools v0.13.0
 	mvdan.cc/gofumpt v0.4.0
 )
 
@@ -58,6 +59,5 @@ require (
 	golang.org/x/crypto v0.15.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sys v0.14.0 // indirect
-	golang.org/x/tools v0.13.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 )
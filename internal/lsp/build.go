@@ -3,6 +3,7 @@ package lsp
 import (
 	"fmt"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -12,7 +13,7 @@ import (
 )
 
 type ErrorInfo struct {
-	FileName string
+	FileName string // absolute
 	Line     int
 	Column   int
 	Span     []int
@@ -20,10 +21,16 @@ type ErrorInfo struct {
 	Tool     string
 }
 
-func (s *server) TranspileAndBuild(file *GnoFile) ([]ErrorInfo, error) {
-	pkgDir := filepath.Dir(file.URI.Filename())
-	pkgName := filepath.Base(pkgDir)
-	tmpDir := filepath.Join(s.env.GNOHOME, "gnopls", "tmp", pkgName)
+// tmpRoot returns the dir where packages are copied before being built.
+func (s *server) tmpRoot() string {
+	return filepath.Join(s.env.GNOHOME, "gnopls", "tmp")
+}
+
+// TranspileAndBuild transpiles and builds the package pkgDir, and returns
+// its errors.
+func (s *server) TranspileAndBuild(pkgDir string) ([]ErrorInfo, error) {
+	// Keyed by the whole dir, packages may have the same name
+	tmpDir := filepath.Join(s.tmpRoot(), strings.TrimPrefix(pkgDir, filepath.VolumeName(pkgDir)))
 
 	err := copyDir(pkgDir, tmpDir)
 	if err != nil {
@@ -33,12 +40,12 @@ func (s *server) TranspileAndBuild(file *GnoFile) ([]ErrorInfo, error) {
 	preOut, _ := tools.Transpile(tmpDir)
 	slog.Info(string(preOut))
 	if len(preOut) > 0 {
-		return parseErrors(file, string(preOut), "transpile")
+		return parseErrors(pkgDir, string(preOut), "transpile")
 	}
 
 	buildOut, _ := tools.Build(tmpDir)
 	slog.Info(string(buildOut))
-	return parseErrors(file, string(buildOut), "build")
+	return parseErrors(pkgDir, string(buildOut), "build")
 }
 
 // This is used to extract information from the `gno build` command
@@ -60,7 +67,7 @@ var errorRe = regexp.MustCompile(`(?m)^([^#]+?):(\d+):(\d+):(.+)$`)
 //
 // 1 go build errors
 // ```
-func parseErrors(file *GnoFile, output, cmd string) ([]ErrorInfo, error) {
+func parseErrors(pkgDir, output, cmd string) ([]ErrorInfo, error) {
 	errors := []ErrorInfo{}
 
 	matches := errorRe.FindAllStringSubmatch(output, -1)
@@ -80,16 +87,17 @@ func parseErrors(file *GnoFile, output, cmd string) ([]ErrorInfo, error) {
 		}
 		slog.Info("parsing", "line", line, "column", column, "msg", match[4])
 
-		errorInfo := findError(file, match[1], line, column, match[4], cmd)
+		errorInfo := findError(pkgDir, match[1], line, column, match[4], cmd)
 		errors = append(errors, errorInfo)
 	}
 
 	return errors, nil
 }
 
-// findError finds the error in the document, shifting the line and column
-// numbers to account for the header information in the generated Go file.
-func findError(file *GnoFile, fname string, line, col int, msg string, tool string) ErrorInfo {
+// findError finds the error in the file fname of the package pkgDir,
+// shifting the line and column numbers to account for the header
+// information in the generated Go file.
+func findError(pkgDir, fname string, line, col int, msg string, tool string) ErrorInfo {
 	msg = strings.TrimSpace(msg)
 	// TODO: can be removed?
 	// see: https://github.com/gnolang/gno/pull/1670
@@ -111,7 +119,7 @@ func findError(file *GnoFile, fname string, line, col int, msg string, tool stri
 	tokens := strings.Fields(needle)
 
 	errorInfo := ErrorInfo{
-		FileName: strings.TrimPrefix(GoToGnoFileName(filepath.Base(fname)), "."),
+		FileName: filepath.Join(pkgDir, strings.TrimPrefix(GoToGnoFileName(filepath.Base(fname)), ".")),
 		Line:     line,
 		Column:   col,
 		Span:     []int{0, 0},
@@ -119,7 +127,9 @@ func findError(file *GnoFile, fname string, line, col int, msg string, tool stri
 		Tool:     tool,
 	}
 
-	lines := strings.SplitAfter(string(file.Src), "\n")
+	// Errors may be reported in any file of the package
+	src, _ := os.ReadFile(errorInfo.FileName)
+	lines := strings.SplitAfter(string(src), "\n")
 	for i, l := range lines {
 		if i != line-1 { // zero-indexed
 			continue
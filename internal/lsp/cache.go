@@ -1,11 +1,32 @@
 package lsp
 
 import (
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
 	cmap "github.com/orcaman/concurrent-map/v2"
+	"go.lsp.dev/protocol"
 )
 
 type Cache struct {
 	pkgs cmap.ConcurrentMap[string, *Package]
+
+	// filetests are type-checked as standalone packages,
+	// they are keyed by their absolute file path.
+	filetests cmap.ConcurrentMap[string, *Package]
+
+	// tests contains the test variants of packages, keyed by the
+	// absolute path of their test files: package files with in-package
+	// tests, or the external `_test` package.
+	tests cmap.ConcurrentMap[string, *Package]
+
+	// generation is incremented whenever packages are updated or
+	// removed, to invalidate what is computed from all of them.
+	generation atomic.Uint64
 }
 
 func (c *Cache) lookupSymbol(pkgPath, symbol string) (*Symbol, bool) {
@@ -22,9 +43,22 @@ func (c *Cache) lookupSymbol(pkgPath, symbol string) (*Symbol, bool) {
 	return nil, false
 }
 
+// lookupPackage returns the package the file belongs to.
+func (c *Cache) lookupPackage(filename string) (*Package, bool) {
+	if isFiletest(filename) {
+		return c.filetests.Get(filename)
+	}
+	if isTestFile(filename) {
+		return c.tests.Get(filename)
+	}
+	return c.pkgs.Get(filepath.Dir(filename))
+}
+
 func NewCache() *Cache {
 	return &Cache{
-		pkgs: cmap.New[*Package](),
+		pkgs:      cmap.New[*Package](),
+		filetests: cmap.New[*Package](),
+		tests:     cmap.New[*Package](),
 	}
 }
 
@@ -49,4 +83,193 @@ func (s *server) UpdateCache(pkgPath string) {
 
 	pkg.TypeCheckResult = res // set typeCheck result
 	s.cache.pkgs.Set(pkgPath, pkg)
+
+	s.updateTests(pkgPath, pkginfo, res)
+	s.updateFiletests(pkgPath, pkginfo.ImportPath, res)
+	s.cache.generation.Add(1)
+}
+
+// typeCheckFile returns the package of file type-checked using the
+// unsaved content of file. The result is kept until file changes or
+// its package is updated.
+func (s *server) typeCheckFile(file *GnoFile) (*TypeCheckResult, bool) {
+	pkg, ok := s.cache.lookupPackage(file.URI.Filename())
+	if !ok || pkg.TypeCheckResult == nil {
+		return nil, false
+	}
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	if file.checked != nil && file.checkedFrom == pkg {
+		return file.checked, true
+	}
+	res := pkg.TypeCheckResult.overlay(filepath.Base(file.URI.Filename()), file.Src)
+	if res == nil {
+		return nil, false
+	}
+	file.checked, file.checkedFrom = res, pkg
+	return res, true
+}
+
+// typeCheckPosition returns the package of file type-checked using its
+// unsaved content, the parsed file and the position p in it.
+func (s *server) typeCheckPosition(file *GnoFile, p protocol.Position) (*TypeCheckResult, *ast.File, token.Pos, bool) {
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil, nil, token.NoPos, false
+	}
+	f, pos, ok := tcr.filePosition(file, p)
+	return tcr, f, pos, ok
+}
+
+// filePosition returns file parsed in tcr and the position p in it.
+func (tcr *TypeCheckResult) filePosition(file *GnoFile, p protocol.Position) (*ast.File, token.Pos, bool) {
+	f, tf := tcr.file(filepath.Base(file.URI.Filename()))
+	if f == nil {
+		return nil, token.NoPos, false
+	}
+	pos := posFromPosition(tf, p)
+	return f, pos, pos.IsValid()
+}
+
+// updateTests type-checks the test variants of the package pkginfo:
+// the package along with its in-package tests, then the external
+// `_test` package importing the former.
+func (s *server) updateTests(pkgPath string, pkginfo *PackageInfo, res *TypeCheckResult) {
+	files, err := ListGnoFiles(pkgPath)
+	if err != nil {
+		return
+	}
+	testFiles := filterGnoFiles(files, isTestFile)
+	removeStale(s.cache.tests, pkgPath, testFiles)
+	if len(testFiles) == 0 {
+		return
+	}
+
+	pkgName := ""
+	if res.pkg != nil {
+		pkgName = res.pkg.Name()
+	}
+	var inFiles, xFiles []string
+	for _, fname := range testFiles {
+		src, err := os.ReadFile(fname)
+		if err != nil {
+			continue
+		}
+		name := packageName(src)
+		if strings.HasSuffix(name, "_test") && name != pkgName {
+			xFiles = append(xFiles, fname)
+		} else {
+			inFiles = append(inFiles, fname)
+		}
+	}
+
+	// package files + in-package tests
+	testRes := res
+	pkgFiles := filterGnoFiles(files, isPackageFile)
+	if _, r := s.updateTestVariant(pkgPath, pkginfo.ImportPath, pkgFiles, inFiles, nil); r != nil {
+		testRes = r
+	}
+
+	// external `_test` package, importing the variant above
+	imports := map[string]*TypeCheckResult{}
+	if pkginfo.ImportPath != "" && testRes.pkg != nil {
+		imports[pkginfo.ImportPath] = withoutErrors(testRes)
+	}
+	importPath := pkginfo.ImportPath + "_test"
+	s.updateTestVariant(pkgPath, importPath, nil, xFiles, imports)
+}
+
+// updateTestVariant type-checks the package made of files and tests, and
+// caches it for every test file.
+func (s *server) updateTestVariant(pkgPath, importPath string, files, tests []string, imports map[string]*TypeCheckResult) (*Package, *TypeCheckResult) {
+	if len(tests) == 0 {
+		return nil, nil
+	}
+	all := append(append([]string{}, files...), tests...)
+	pkg, err := packageFromFiles(pkgPath, all, false)
+	if err != nil {
+		return nil, nil
+	}
+	fileInfos, err := readFileInfos(all)
+	if err != nil {
+		return nil, nil
+	}
+	pkginfo := &PackageInfo{
+		Dir:        pkgPath,
+		ImportPath: importPath,
+		Files:      fileInfos,
+	}
+
+	tc, errs := NewTypeCheck()
+	tc.cfg.Importer = tc // set typeCheck importer
+	for path, res := range imports {
+		tc.cache.Set(path, res)
+	}
+	res := pkginfo.TypeCheck(tc)
+	res.err = *errs
+
+	pkg.ImportPath = importPath
+	pkg.TypeCheckResult = res
+	for _, fname := range tests {
+		s.cache.tests.Set(fname, pkg)
+	}
+	return pkg, res
+}
+
+// withoutErrors returns a copy of res to be imported by another
+// package: errors are reported by the package itself.
+func withoutErrors(res *TypeCheckResult) *TypeCheckResult {
+	imported := *res
+	imported.err = nil
+	return &imported
+}
+
+// removeStale removes the entries of m located in dir which are
+// not part of files anymore.
+func removeStale(m cmap.ConcurrentMap[string, *Package], dir string, files []string) {
+	keep := map[string]bool{}
+	for _, f := range files {
+		keep[f] = true
+	}
+	for _, k := range m.Keys() {
+		if filepath.Dir(k) == dir && !keep[k] {
+			m.Remove(k)
+		}
+	}
+}
+
+// updateFiletests type-checks every filetest of pkgPath. Filetests
+// importing the package itself use res instead of looking it up in
+// `examples`.
+func (s *server) updateFiletests(pkgPath, importPath string, res *TypeCheckResult) {
+	files, err := ListGnoFiles(pkgPath)
+	if err != nil {
+		return
+	}
+	filetests := filterGnoFiles(files, isFiletest)
+	removeStale(s.cache.filetests, pkgPath, filetests)
+	for _, fname := range filetests {
+		pkg, err := packageFromFiles(pkgPath, []string{fname}, false)
+		if err != nil {
+			s.cache.filetests.Remove(fname)
+			continue
+		}
+		pkginfo, err := getFiletestInfo(fname)
+		if err != nil {
+			s.cache.filetests.Remove(fname)
+			continue
+		}
+
+		tc, errs := NewTypeCheck()
+		tc.cfg.Importer = tc // set typeCheck importer
+		if importPath != "" && res.pkg != nil {
+			tc.cache.Set(importPath, withoutErrors(res))
+		}
+		ftres := pkginfo.TypeCheck(tc)
+		ftres.err = *errs
+
+		pkg.ImportPath = pkginfo.ImportPath
+		pkg.TypeCheckResult = ftres
+		s.cache.filetests.Set(fname, pkg)
+	}
 }
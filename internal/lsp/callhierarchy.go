@@ -0,0 +1,231 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/types"
+	"sort"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// callHierarchyData identifies the function of a call hierarchy item.
+type callHierarchyData struct {
+	// URI is the document the hierarchy was prepared from, packages
+	// are type-checked along with its package.
+	URI  protocol.DocumentURI `json:"u"`
+	Pkg  string               `json:"p"`
+	Func string               `json:"f"` // types.Func.FullName
+}
+
+func (s *server) PrepareCallHierarchy(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.CallHierarchyPrepareParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	uri := params.TextDocument.URI
+	file, ok := s.snapshot.Get(uri.Filename())
+	if !ok {
+		return reply(ctx, nil, errors.New("snapshot not found"))
+	}
+	tcr, f, pos, ok := s.typeCheckPosition(file, params.Position)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	_, obj := tcr.identAt(f, pos)
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	owner, ok := tcr.owner(fn)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	decl := funcDecl(owner, fn.FullName())
+	if decl == nil {
+		return reply(ctx, nil, nil)
+	}
+	return reply(ctx, []protocol.CallHierarchyItem{callHierarchyItem(owner, decl, uri)}, nil)
+}
+
+func (s *server) IncomingCalls(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.CallHierarchyIncomingCallsParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+	data, tcr, ok := s.callHierarchyItemData(params.Item)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+
+	calls := []protocol.CallHierarchyIncomingCall{}
+	for _, res := range s.comparablePackages(tcr) {
+		for _, file := range res.files {
+			for _, d := range file.Decls {
+				decl, ok := d.(*ast.FuncDecl)
+				if !ok || decl.Body == nil {
+					continue
+				}
+				var ranges []protocol.Range
+				for _, id := range funcRefs(res, decl) {
+					if fn := res.info.Uses[id].(*types.Func); fn.FullName() == data.Func {
+						ranges = append(ranges, res.location(id.Pos(), id.End()).Range)
+					}
+				}
+				if len(ranges) == 0 {
+					continue
+				}
+				calls = append(calls, protocol.CallHierarchyIncomingCall{
+					From:       callHierarchyItem(res, decl, data.URI),
+					FromRanges: ranges,
+				})
+			}
+		}
+	}
+	return reply(ctx, calls, nil)
+}
+
+func (s *server) OutgoingCalls(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.CallHierarchyOutgoingCallsParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+	data, tcr, ok := s.callHierarchyItemData(params.Item)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+
+	var res *TypeCheckResult
+	for _, r := range s.comparablePackages(tcr) {
+		if r.pkg.Path() == data.Pkg {
+			res = r
+			break
+		}
+	}
+	if res == nil {
+		return reply(ctx, nil, nil)
+	}
+	decl := funcDecl(res, data.Func)
+	if decl == nil {
+		return reply(ctx, nil, nil)
+	}
+
+	// Group the calls by callee
+	byCallee := map[string]*protocol.CallHierarchyOutgoingCall{}
+	for _, id := range funcRefs(res, decl) {
+		fn := res.info.Uses[id].(*types.Func)
+		call, ok := byCallee[fn.FullName()]
+		if !ok {
+			owner, ok := res.owner(fn)
+			if !ok {
+				continue
+			}
+			callee := funcDecl(owner, fn.FullName())
+			if callee == nil {
+				continue // e.g. interface methods
+			}
+			call = &protocol.CallHierarchyOutgoingCall{
+				To: callHierarchyItem(owner, callee, data.URI),
+			}
+			byCallee[fn.FullName()] = call
+		}
+		call.FromRanges = append(call.FromRanges, res.location(id.Pos(), id.End()).Range)
+	}
+
+	calls := make([]protocol.CallHierarchyOutgoingCall, 0, len(byCallee))
+	for _, call := range byCallee {
+		calls = append(calls, *call)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].To.Name < calls[j].To.Name
+	})
+	return reply(ctx, calls, nil)
+}
+
+// callHierarchyItemData decodes the data of item, and returns the
+// type-checked package of the document it was prepared from.
+func (s *server) callHierarchyItemData(item protocol.CallHierarchyItem) (*callHierarchyData, *TypeCheckResult, bool) {
+	b, err := json.Marshal(item.Data)
+	if err != nil {
+		return nil, nil, false
+	}
+	var data callHierarchyData
+	if err := json.Unmarshal(b, &data); err != nil || data.Func == "" {
+		return nil, nil, false
+	}
+	file, ok := s.snapshot.Get(data.URI.Filename())
+	if !ok {
+		return nil, nil, false
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil, nil, false
+	}
+	return &data, tcr, true
+}
+
+// funcRefs returns the references to functions and methods in the body
+// of decl, including the ones in function literals and method values
+// (e.g. `f := t.Method`).
+func funcRefs(res *TypeCheckResult, decl *ast.FuncDecl) []*ast.Ident {
+	var refs []*ast.Ident
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if _, ok := res.info.Uses[id].(*types.Func); ok {
+				refs = append(refs, id)
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+// funcDecl returns the declaration of the function named fullName
+// (see types.Func.FullName) in res.
+func funcDecl(res *TypeCheckResult, fullName string) *ast.FuncDecl {
+	for _, file := range res.files {
+		for _, d := range file.Decls {
+			decl, ok := d.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if fn, ok := res.info.Defs[decl.Name].(*types.Func); ok && fn.FullName() == fullName {
+				return decl
+			}
+		}
+	}
+	return nil
+}
+
+// callHierarchyItem returns the item of the function decl of res.
+func callHierarchyItem(res *TypeCheckResult, decl *ast.FuncDecl, uri protocol.DocumentURI) protocol.CallHierarchyItem {
+	fn := res.info.Defs[decl.Name].(*types.Func)
+	kind := protocol.SymbolKindFunction
+	name := fn.Name()
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+		kind = protocol.SymbolKindMethod
+		recvName := types.TypeString(recv.Type(), func(*types.Package) string { return "" })
+		if _, ok := recv.Type().(*types.Pointer); ok {
+			recvName = "(" + recvName + ")"
+		}
+		name = recvName + "." + name
+	}
+	loc := res.location(decl.Pos(), decl.End())
+	return protocol.CallHierarchyItem{
+		Name:           name,
+		Kind:           kind,
+		Detail:         fn.Pkg().Path(),
+		URI:            loc.URI,
+		Range:          loc.Range,
+		SelectionRange: res.location(decl.Name.Pos(), decl.Name.End()).Range,
+		Data: callHierarchyData{
+			URI:  uri,
+			Pkg:  fn.Pkg().Path(),
+			Func: fn.FullName(),
+		},
+	}
+}
@@ -17,7 +17,10 @@ import (
 
 	"github.com/gnolang/gno/gnovm/pkg/gnomod"
 	"github.com/harry-hov/gnopls/internal/env"
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"go.lsp.dev/protocol"
 	"go.uber.org/multierr"
+	"golang.org/x/tools/go/ast/astutil"
 )
 
 type FileInfo struct {
@@ -39,7 +42,9 @@ type PackageGetter interface {
 // Note: it doesn't work for relative path
 func GetPackageInfo(path string) (*PackageInfo, error) {
 	// if not absolute, assume its import path
+	importPath := ""
 	if !filepath.IsAbs(path) {
+		importPath = path
 		if env.GlobalEnv.GNOROOT == "" {
 			// if GNOROOT is unknown, we can't locate the
 			// `examples` and `stdlibs`
@@ -51,7 +56,15 @@ func GetPackageInfo(path string) (*PackageInfo, error) {
 			path = filepath.Join(env.GlobalEnv.GNOROOT, "gnovm", "stdlibs", path)
 		}
 	}
-	return getPackageInfo(path)
+	pi, err := getPackageInfo(path)
+	if err != nil {
+		return nil, err
+	}
+	if pi.ImportPath == "" {
+		// stdlibs don't have a gno.mod
+		pi.ImportPath = importPath
+	}
+	return pi, nil
 }
 
 func getPackageInfo(path string) (*PackageInfo, error) {
@@ -66,12 +79,43 @@ func getPackageInfo(path string) (*PackageInfo, error) {
 	} else {
 		importpath = gm.Module.Mod.Path
 	}
+	files, err := readFileInfos(filterGnoFiles(filenames, isPackageFile))
+	if err != nil {
+		return nil, err
+	}
+	return &PackageInfo{
+		ImportPath: importpath,
+		Dir:        path,
+		Files:      files,
+	}, nil
+}
+
+// getFiletestInfo returns the filetest fname as a standalone package.
+// Its import path is set by the `PKGPATH` directive, defaulting to `main`.
+func getFiletestInfo(fname string) (*PackageInfo, error) {
+	files, err := readFileInfos([]string{fname})
+	if err != nil {
+		return nil, err
+	}
+	return &PackageInfo{
+		ImportPath: filetestPkgPath(files[0].Body),
+		Dir:        filepath.Dir(fname),
+		Files:      files,
+	}, nil
+}
+
+// packageName returns the package name of src, if it can be parsed.
+func packageName(src []byte) string {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly)
+	if err != nil {
+		return ""
+	}
+	return f.Name.Name
+}
+
+func readFileInfos(filenames []string) ([]*FileInfo, error) {
 	files := []*FileInfo{}
 	for _, fname := range filenames {
-		if strings.HasSuffix(fname, "_test.gno") ||
-			strings.HasSuffix(fname, "_filetest.gno") {
-			continue
-		}
 		absPath, err := filepath.Abs(fname)
 		if err != nil {
 			return nil, err
@@ -83,22 +127,20 @@ func getPackageInfo(path string) (*PackageInfo, error) {
 		text := string(bsrc)
 		files = append(files, &FileInfo{Name: filepath.Base(fname), Body: text})
 	}
-	return &PackageInfo{
-		ImportPath: importpath,
-		Dir:        path,
-		Files:      files,
-	}, nil
+	return files, nil
 }
 
 type TypeCheck struct {
-	cache map[string]*TypeCheckResult
+	// cache are the imported packages, keyed by import path. It is
+	// shared by overlays, which may be type-checked concurrently.
+	cache cmap.ConcurrentMap[string, *TypeCheckResult]
 	cfg   *types.Config
 }
 
 func NewTypeCheck() (*TypeCheck, *error) {
 	var errs error
 	return &TypeCheck{
-		cache: map[string]*TypeCheckResult{},
+		cache: cmap.New[*TypeCheckResult](),
 		cfg: &types.Config{
 			Error: func(err error) {
 				errs = multierr.Append(errs, err)
@@ -113,17 +155,17 @@ func (tc *TypeCheck) Import(path string) (*types.Package, error) {
 
 // ImportFrom returns the imported package for the given import path
 func (tc *TypeCheck) ImportFrom(path, _ string, _ types.ImportMode) (*types.Package, error) {
-	if pkg, ok := tc.cache[path]; ok {
+	if pkg, ok := tc.cache.Get(path); ok {
 		return pkg.pkg, pkg.err
 	}
 	pkg, err := GetPackageInfo(path)
 	if err != nil {
 		err := fmt.Errorf("package %q not found", path)
-		tc.cache[path] = &TypeCheckResult{err: err}
+		tc.cache.Set(path, &TypeCheckResult{err: err})
 		return nil, err
 	}
 	res := pkg.TypeCheck(tc)
-	tc.cache[path] = res
+	tc.cache.Set(path, res)
 	return res.pkg, res.err
 }
 
@@ -141,22 +183,23 @@ func (pi *PackageInfo) TypeCheck(tc *TypeCheck) *TypeCheckResult {
 	files := make([]*ast.File, 0, len(pi.Files))
 	var errs error
 	for _, f := range pi.Files {
-		if !strings.HasSuffix(f.Name, ".gno") ||
-			strings.HasSuffix(f.Name, "_filetest.gno") ||
-			strings.HasSuffix(f.Name, "_test.gno") {
+		if !strings.HasSuffix(f.Name, ".gno") {
 			continue
 		}
 
 		pgf, err := parser.ParseFile(fset, f.Name, f.Body, parser.ParseComments|parser.DeclarationErrors|parser.SkipObjectResolution)
 		if err != nil {
 			errs = multierr.Append(errs, err)
-			continue
+			// Keep partial files, e.g. while typing `x.`
+			if pgf == nil || pgf.Name == nil {
+				continue
+			}
 		}
 
 		files = append(files, pgf)
 	}
 	pkg, err := tc.cfg.Check(pi.ImportPath, fset, files, info)
-	return &TypeCheckResult{pkg: pkg, fset: fset, files: files, info: info, err: err}
+	return &TypeCheckResult{pkg: pkg, fset: fset, files: files, info: info, err: err, pkginfo: pi, tc: tc}
 }
 
 type TypeCheckResult struct {
@@ -165,6 +208,156 @@ type TypeCheckResult struct {
 	files []*ast.File
 	info  *types.Info
 	err   error
+
+	pkginfo *PackageInfo
+	tc      *TypeCheck
+}
+
+// overlay type-checks again the package of tcr, replacing the content
+// of the file name with src. Imported packages are reused from tcr.
+func (tcr *TypeCheckResult) overlay(name string, src []byte) *TypeCheckResult {
+	if tcr.pkginfo == nil || tcr.tc == nil {
+		return nil
+	}
+	files := make([]*FileInfo, 0, len(tcr.pkginfo.Files))
+	for _, f := range tcr.pkginfo.Files {
+		if f.Name == name {
+			f = &FileInfo{Name: name, Body: string(src)}
+		}
+		files = append(files, f)
+	}
+	pi := &PackageInfo{
+		Dir:        tcr.pkginfo.Dir,
+		ImportPath: tcr.pkginfo.ImportPath,
+		Files:      files,
+	}
+
+	return typeCheckWith(pi, tcr.tc.cache)
+}
+
+// typeCheckWith type-checks pi, reusing the imported packages of cache
+// and adding the missing ones to it.
+func typeCheckWith(pi *PackageInfo, cache cmap.ConcurrentMap[string, *TypeCheckResult]) *TypeCheckResult {
+	tc, errs := NewTypeCheck()
+	tc.cache = cache
+	tc.cfg.Importer = tc // set typeCheck importer
+	res := pi.TypeCheck(tc)
+	res.err = *errs
+	return res
+}
+
+// file returns the parsed file name of tcr.
+func (tcr *TypeCheckResult) file(name string) (*ast.File, *token.File) {
+	for _, f := range tcr.files {
+		tf := tcr.fset.File(f.Pos())
+		if tf != nil && tf.Name() == name {
+			return f, tf
+		}
+	}
+	return nil, nil
+}
+
+// objectPosition returns the position of obj, with an absolute
+// filename. obj belongs to tcr or to one of the packages it imports.
+func (tcr *TypeCheckResult) objectPosition(obj types.Object) (token.Position, bool) {
+	if !obj.Pos().IsValid() {
+		return token.Position{}, false
+	}
+	owner, ok := tcr.owner(obj)
+	if !ok || owner.pkginfo == nil {
+		return token.Position{}, false
+	}
+	pos := owner.fset.Position(obj.Pos())
+	pos.Filename = filepath.Join(owner.pkginfo.Dir, pos.Filename)
+	return pos, true
+}
+
+// objectLocation returns the location of the name of obj.
+func (tcr *TypeCheckResult) objectLocation(obj types.Object) (protocol.Location, bool) {
+	p, ok := tcr.objectPosition(obj)
+	if !ok {
+		return protocol.Location{}, false
+	}
+	return protocol.Location{
+		URI: getURI(p.Filename),
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(p.Line - 1), Character: uint32(p.Column - 1)},
+			End:   protocol.Position{Line: uint32(p.Line - 1), Character: uint32(p.Column - 1 + len(obj.Name()))},
+		},
+	}, true
+}
+
+// location returns the location of the range [pos, end) of tcr.
+func (tcr *TypeCheckResult) location(pos, end token.Pos) protocol.Location {
+	filename := tcr.fset.Position(pos).Filename
+	if tcr.pkginfo != nil {
+		filename = filepath.Join(tcr.pkginfo.Dir, filename)
+	}
+	return protocol.Location{
+		URI: getURI(filename),
+		Range: protocol.Range{
+			Start: positionOf(tcr.fset, pos),
+			End:   positionOf(tcr.fset, end),
+		},
+	}
+}
+
+// owner returns the result of the package obj belongs to, either
+// tcr or one of the packages it imports.
+func (tcr *TypeCheckResult) owner(obj types.Object) (*TypeCheckResult, bool) {
+	if obj.Pkg() == nil {
+		return nil, false
+	}
+	if obj.Pkg() == tcr.pkg {
+		return tcr, true
+	}
+	if tcr.tc == nil {
+		return nil, false
+	}
+	res, ok := tcr.tc.cache.Get(obj.Pkg().Path())
+	if !ok || res.pkg != obj.Pkg() || res.fset == nil {
+		return nil, false
+	}
+	return res, true
+}
+
+// identAt returns the identifier of f at pos, along with the object
+// it defines or refers to. The cursor can be right after the identifier.
+func (tcr *TypeCheckResult) identAt(f *ast.File, pos token.Pos) (*ast.Ident, types.Object) {
+	for _, p := range []token.Pos{pos, pos - 1} {
+		paths, _ := astutil.PathEnclosingInterval(f, p, p)
+		if len(paths) == 0 {
+			continue
+		}
+		id, ok := paths[0].(*ast.Ident)
+		if !ok {
+			continue
+		}
+		if obj := tcr.info.Uses[id]; obj != nil {
+			return id, obj
+		}
+		return id, tcr.info.Defs[id]
+	}
+	return nil, nil
+}
+
+// positionOf converts pos to a protocol.Position.
+func positionOf(fset *token.FileSet, pos token.Pos) protocol.Position {
+	p := fset.Position(pos)
+	return protocol.Position{Line: uint32(p.Line - 1), Character: uint32(p.Column - 1)}
+}
+
+// posFromPosition converts p to a token.Pos of tf.
+func posFromPosition(tf *token.File, p protocol.Position) token.Pos {
+	line := int(p.Line) + 1
+	if line > tf.LineCount() {
+		return token.NoPos
+	}
+	pos := tf.LineStart(line) + token.Pos(p.Character)
+	if int(pos) > tf.Base()+tf.Size() {
+		return token.Pos(tf.Base() + tf.Size())
+	}
+	return pos
 }
 
 func (tcr *TypeCheckResult) Errors() []ErrorInfo {
@@ -176,6 +369,10 @@ func (tcr *TypeCheckResult) Errors() []ErrorInfo {
 			slog.Error("TYPECHECK", "skipped", err)
 		}
 		filename := strings.TrimSpace(parts[0])
+		if !filepath.IsAbs(filename) && tcr.pkginfo != nil {
+			// Files are parsed with their base name
+			filename = filepath.Join(tcr.pkginfo.Dir, filename)
+		}
 		line, _ := strconv.Atoi(strings.TrimSpace(parts[1]))
 		col, _ := strconv.Atoi(strings.TrimSpace(parts[2]))
 		msg := strings.TrimSpace(strings.Join(parts[3:], ":"))
@@ -193,7 +390,7 @@ func (tcr *TypeCheckResult) Errors() []ErrorInfo {
 
 // Prints types.Info in a tabular form
 // Kept only for debugging purpose.
-func formatTypeInfo(fset token.FileSet, info *types.Info) string {
+func formatTypeInfo(fset *token.FileSet, info *types.Info) string {
 	var items []string = nil
 	for expr, tv := range info.Types {
 		var buf strings.Builder
@@ -215,7 +412,7 @@ func formatTypeInfo(fset token.FileSet, info *types.Info) string {
 // Prints types.Info in a tabular form
 // Kept only for debugging purpose.
 func getTypeAndValue(
-	fset token.FileSet,
+	fset *token.FileSet,
 	info *types.Info,
 	tok string,
 	line, offset int,
@@ -248,7 +445,7 @@ func getTypeAndValue(
 // Use getTypeAndValue instead
 // TODO: should be removed
 func getTypeAndValueLight(
-	fset token.FileSet,
+	fset *token.FileSet,
 	info *types.Info,
 	tok string,
 	line int,
@@ -0,0 +1,58 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func (s *server) CodeAction(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.CodeActionParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	uri := params.TextDocument.URI
+	only := params.Context.Only
+	actions := []protocol.CodeAction{}
+	if file, ok := s.snapshot.Get(uri.Filename()); ok {
+		if isFiletest(uri.Filename()) {
+			actions = append(actions, codeActionsFiletest(file, params)...)
+		}
+		if kindRequested(only, protocol.RefactorExtract) {
+			actions = append(actions, s.codeActionsExtract(file, params.Range)...)
+		}
+		if kindRequested(only, protocol.RefactorInline) {
+			actions = append(actions, s.codeActionsInline(file, params.Range)...)
+		}
+		if kindRequested(only, protocol.RefactorRewrite) {
+			actions = append(actions, s.codeActionsStub(file, params.Range)...)
+			actions = append(actions, s.codeActionsFillStruct(file, params.Range)...)
+		}
+		if kindRequested(only, refactorChangeSignature) {
+			actions = append(actions, s.codeActionsChangeSignature(file, params.Range)...)
+		}
+		if kindRequested(only, protocol.Source) {
+			actions = append(actions, s.codeActionsGenerateTest(file, params.Range)...)
+		}
+	}
+
+	return reply(ctx, actions, nil)
+}
+
+// kindRequested reports whether code actions of kind are requested by a
+// client asking only for the kinds only, if any.
+func kindRequested(only []protocol.CodeActionKind, kind protocol.CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, k := range only {
+		if k == kind || strings.HasPrefix(string(kind), string(k)+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package lsp
+
+import (
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestCodeActionOnly(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/r/demo/foo/gno.mod": "module gno.land/r/demo/foo\n",
+		"gno.land/r/demo/foo/foo.gno": `package foo
+
+func /*fn*/Add(/*param*/a, b int) int {
+	return /*start*/a + b/*end*/
+}
+`,
+	})
+	expr := protocol.Range{Start: locs["start"].Range.Start, End: locs["end"].Range.Start}
+	for _, tt := range []struct {
+		only []protocol.CodeActionKind
+		rng  protocol.Range
+		want bool // some action
+	}{
+		{only: []protocol.CodeActionKind{protocol.RefactorExtract}, rng: expr, want: true},
+		{only: []protocol.CodeActionKind{protocol.QuickFix}, rng: expr},
+		{only: []protocol.CodeActionKind{protocol.Source}, rng: locs["fn"].Range, want: true},
+		{only: []protocol.CodeActionKind{protocol.Refactor}, rng: locs["param"].Range, want: true},
+		{only: []protocol.CodeActionKind{protocol.RefactorInline}, rng: locs["param"].Range},
+	} {
+		var actions []protocol.CodeAction
+		err := request(t, s, "textDocument/codeAction", protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: locs["start"].URI},
+			Range:        tt.rng,
+			Context:      protocol.CodeActionContext{Only: tt.only},
+		}, &actions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(actions) > 0) != tt.want {
+			t.Errorf("%v: got %d actions, want some: %v", tt.only, len(actions), tt.want)
+		}
+		for _, action := range actions {
+			if !kindRequested(tt.only, action.Kind) {
+				t.Errorf("%v: unexpected action %q of kind %s", tt.only, action.Title, action.Kind)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func (s *server) CodeLens(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.CodeLensParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	uri := params.TextDocument.URI
+	if !isTestFile(uri.Filename()) {
+		return reply(ctx, nil, nil)
+	}
+
+	// Get snapshot of the current file
+	file, ok := s.snapshot.Get(uri.Filename())
+	if !ok {
+		return reply(ctx, nil, errors.New("snapshot not found"))
+	}
+	// Try parsing current file
+	pgf, err := file.ParseGno2(ctx)
+	if err != nil {
+		return reply(ctx, nil, errors.New("cannot parse gno file"))
+	}
+
+	lenses := []protocol.CodeLens{
+		{
+			Range: nodeToRange(pgf.Fset, pgf.File.Name),
+			Command: &protocol.Command{
+				Title:     "run package tests",
+				Command:   "gnopls.runTests",
+				Arguments: []interface{}{runTestsArgs{URI: uri}},
+			},
+		},
+	}
+	for _, decl := range pgf.File.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || !isTestFunc(fd) {
+			continue
+		}
+		lenses = append(lenses, protocol.CodeLens{
+			Range: nodeToRange(pgf.Fset, fd.Name),
+			Command: &protocol.Command{
+				Title:   "run test",
+				Command: "gnopls.runTests",
+				Arguments: []interface{}{runTestsArgs{
+					URI:   uri,
+					Tests: []string{fd.Name.Name},
+				}},
+			},
+		})
+	}
+
+	return reply(ctx, lenses, nil)
+}
+
+// isTestFunc reports whether fd is a `func TestXxx(t *testing.T)`.
+func isTestFunc(fd *ast.FuncDecl) bool {
+	if fd.Recv != nil || !strings.HasPrefix(fd.Name.Name, "Test") {
+		return false
+	}
+	// TestXxx, but not Testxxx
+	if rest := fd.Name.Name[len("Test"):]; rest != "" {
+		r, _ := utf8.DecodeRuneInString(rest)
+		if unicode.IsLower(r) {
+			return false
+		}
+	}
+	params := fd.Type.Params.List
+	if len(params) != 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "T"
+}
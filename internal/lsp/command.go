@@ -0,0 +1,176 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+
+	"github.com/harry-hov/gnopls/internal/version"
+)
+
+// commandHandler executes a `workspace/executeCommand` request.
+// Arguments are passed undecoded, use typedCommand to decode them.
+type commandHandler func(ctx context.Context, s *server, args []json.RawMessage) (any, error)
+
+// commands contains every command supported by `workspace/executeCommand`.
+// It is also used to advertise `ExecuteCommandProvider` in `Initialize`.
+var commands = map[string]commandHandler{
+	"gnopls.version":      typedCommand(cmdVersion),
+	"gnopls.reindex":      typedCommand(cmdReindex),
+	"gnopls.clearCache":   typedCommand(cmdClearCache),
+	"gnopls.listPackages": typedCommand(cmdListPackages),
+	"gnopls.runTests":     typedCommand(cmdRunTests),
+
+	"gnopls.changeSignature":    typedCommand(cmdChangeSignature),
+	"gnopls.implementInterface": typedCommand(cmdImplementInterface),
+	"gnopls.movePackage":        typedCommand(cmdMovePackage),
+	"gnopls.generateTest":       typedCommand(cmdGenerateTest),
+
+	"gnopls.generateFiletest":     typedCommand(cmdGenerateFiletest),
+	"gnopls.updateFiletestOutput": typedCommand(cmdUpdateFiletestOutput),
+}
+
+// commandNames returns the sorted list of registered commands.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// typedCommand wraps fn into a commandHandler which decodes the first
+// command argument (if any) into T.
+func typedCommand[T any](fn func(ctx context.Context, s *server, args T) (any, error)) commandHandler {
+	return func(ctx context.Context, s *server, raw []json.RawMessage) (any, error) {
+		var args T
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw[0], &args); err != nil {
+				return nil, fmt.Errorf("invalid arguments: %w", err)
+			}
+		}
+		return fn(ctx, s, args)
+	}
+}
+
+type workDoneTokenKey struct{}
+
+// workDoneToken returns the progress token sent by the client
+// along with the command, if any.
+func workDoneToken(ctx context.Context) *protocol.ProgressToken {
+	token, _ := ctx.Value(workDoneTokenKey{}).(*protocol.ProgressToken)
+	return token
+}
+
+// executeCommandParams is the same as protocol.ExecuteCommandParams
+// but keeps arguments as raw JSON so they can be decoded by type.
+type executeCommandParams struct {
+	protocol.WorkDoneProgressParams
+
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+func (s *server) ExecuteCommand(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params executeCommandParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	slog.Info("execute command", "command", params.Command)
+
+	handler, ok := commands[params.Command]
+	if !ok {
+		err := fmt.Errorf("%w: unknown command %q", jsonrpc2.ErrInvalidParams, params.Command)
+		s.showMessage(ctx, protocol.MessageTypeError, err.Error())
+		return reply(ctx, nil, err)
+	}
+
+	if params.WorkDoneToken != nil {
+		ctx = context.WithValue(ctx, workDoneTokenKey{}, params.WorkDoneToken)
+	}
+	res, err := handler(ctx, s, params.Arguments)
+	if err != nil {
+		s.showMessage(ctx, protocol.MessageTypeError, fmt.Sprintf("%s: %s", params.Command, err))
+		return reply(ctx, nil, err)
+	}
+	return reply(ctx, res, nil)
+}
+
+// showMessage sends a `window/showMessage` notification to the client.
+func (s *server) showMessage(ctx context.Context, typ protocol.MessageType, msg string) {
+	err := s.conn.Notify(ctx, protocol.MethodWindowShowMessage, protocol.ShowMessageParams{
+		Type:    typ,
+		Message: msg,
+	})
+	if err != nil {
+		slog.Error("show message", "err", err)
+	}
+}
+
+func cmdVersion(ctx context.Context, s *server, _ struct{}) (any, error) {
+	v := version.GetVersion(ctx)
+	s.showMessage(ctx, protocol.MessageTypeInfo, "gnopls "+v)
+	return v, nil
+}
+
+// cmdReindex rebuilds the CompletionStore from `examples` and `stdlibs`.
+func cmdReindex(ctx context.Context, s *server, _ struct{}) (any, error) {
+	store := InitCompletionStore(completionStoreDirs(s.env))
+	s.completionStore.Store(store)
+	msg := fmt.Sprintf("gnopls: indexed %d packages", len(store.pkgs))
+	s.showMessage(ctx, protocol.MessageTypeInfo, msg)
+	return nil, nil
+}
+
+// cmdClearCache drops every package from the Cache and removes the
+// temporary directories used by `TranspileAndBuild`.
+func cmdClearCache(ctx context.Context, s *server, _ struct{}) (any, error) {
+	s.cache.pkgs.Clear()
+	s.cache.generation.Add(1)
+	if err := os.RemoveAll(s.tmpRoot()); err != nil {
+		return nil, err
+	}
+	s.showMessage(ctx, protocol.MessageTypeInfo, "gnopls: cache cleared")
+	return nil, nil
+}
+
+// PackageSummary describes a package known by the server.
+type PackageSummary struct {
+	Name       string `json:"name"`
+	ImportPath string `json:"importPath"`
+	Dir        string `json:"dir,omitempty"`
+	Source     string `json:"source"` // "cache" or "index"
+}
+
+// cmdListPackages returns the packages type-checked in the Cache
+// followed by the packages indexed in the CompletionStore.
+func cmdListPackages(ctx context.Context, s *server, _ struct{}) (any, error) {
+	res := []PackageSummary{}
+	for dir, pkg := range s.cache.pkgs.Items() {
+		res = append(res, PackageSummary{
+			Name:       pkg.Name,
+			ImportPath: pkg.ImportPath,
+			Dir:        dir,
+			Source:     "cache",
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Dir < res[j].Dir
+	})
+	for _, pkg := range s.completionStore.Load().pkgs {
+		res = append(res, PackageSummary{
+			Name:       pkg.Name,
+			ImportPath: pkg.ImportPath,
+			Source:     "index",
+		})
+	}
+	return res, nil
+}
@@ -10,7 +10,6 @@ import (
 	"go/parser"
 	"go/token"
 	"go/types"
-	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -23,6 +22,7 @@ import (
 	"go.lsp.dev/protocol"
 	"go.lsp.dev/uri"
 	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/types/typeutil"
 )
 
 type CompletionStore struct {
@@ -31,9 +31,10 @@ type CompletionStore struct {
 	pkgs []*Package
 }
 
-func (cs *CompletionStore) lookupPkg(pkg string) *Package {
-	for _, p := range cs.pkgs {
-		if p.Name == pkg {
+// storePackage returns the indexed package of import path path.
+func (s *server) storePackage(path string) *Package {
+	for _, p := range s.completionStore.Load().pkgs {
+		if s.storeImportPath(p) == path {
 			return p
 		}
 	}
@@ -72,6 +73,7 @@ func (cs *CompletionStore) lookupSymbolByImports(symbol string, imports []*ast.I
 type Package struct {
 	Name       string
 	ImportPath string
+	Dir        string
 	Symbols    []*Symbol
 
 	Functions  []*Function
@@ -163,26 +165,28 @@ func (s *server) Completion(ctx context.Context, reply jsonrpc2.Replier, req jso
 	if !ok {
 		return reply(ctx, nil, errors.New("snapshot not found"))
 	}
-	// Try parsing current file
-	pgf, err := file.ParseGno2(ctx)
-	if err != nil {
-		return reply(ctx, nil, errors.New("cannot parse gno file"))
+	// Type-check current file, including unsaved changes
+	tcr, f, pos, ok := s.typeCheckPosition(file, params.Position)
+	if !ok {
+		return reply(ctx, nil, nil)
 	}
 
-	// Calculate offset and line
-	offset := file.PositionToOffset(params.Position)
-	line := params.Position.Line + 1 // starts at 0, so adding 1
-
 	// Don't show completion items for imports
-	for _, spec := range pgf.File.Imports {
-		if spec.Path.Pos() <= token.Pos(offset) && token.Pos(offset) <= spec.Path.End() {
+	for _, spec := range f.Imports {
+		if spec.Path.Pos() <= pos && pos <= spec.Path.End() {
+			return reply(ctx, nil, nil)
+		}
+	}
+	// Nor inside comments
+	for _, cg := range f.Comments {
+		if cg.Pos() <= pos && pos <= cg.End() {
 			return reply(ctx, nil, nil)
 		}
 	}
 
 	// Completion is based on what precedes the cursor.
 	// Find the path to the position before pos.
-	paths, _ := astutil.PathEnclosingInterval(pgf.File, token.Pos(offset-1), token.Pos(offset-1))
+	paths, _ := astutil.PathEnclosingInterval(f, pos-1, pos-1)
 	if paths == nil {
 		return reply(ctx, nil, nil)
 	}
@@ -190,189 +194,361 @@ func (s *server) Completion(ctx context.Context, reply jsonrpc2.Replier, req jso
 	// Debug
 	// slog.Info("COMPLETION", "token", fmt.Sprintf("%s", paths[0]))
 
-	// Load pkg from cache
-	pkg, ok := s.cache.pkgs.Get(filepath.Dir(string(uri.Filename())))
-	if !ok {
-		return reply(ctx, nil, nil)
+	cc := &completionContext{
+		prefix:   identPrefix(file.Src, tcr.fset.Position(pos).Offset),
+		expected: expectedType(paths, pos, tcr.info),
+		from:     tcr.pkg,
+		snippets: s.snippetSupport(),
+		uri:      uri,
 	}
 
-	switch n := paths[0].(type) {
-	case *ast.Ident:
-		_, tv := getTypeAndValue(
-			*pgf.Fset,
-			pkg.TypeCheckResult.info, n.Name,
-			int(line),
-			offset,
-		)
-		if tv == nil || tv.Type == nil {
-			return completionPackageIdent(ctx, s, reply, params, pgf, n, true)
-		}
-
-		typeStr := tv.Type.String()
-		if typeStr == "invalid type" {
-			return completionPackageIdent(ctx, s, reply, params, pgf, n, false)
+	if sel := enclosingSelector(paths, pos); sel != nil {
+		if i, ok := sel.X.(*ast.Ident); ok {
+			if pkgName, ok := tcr.info.Uses[i].(*types.PkgName); ok {
+				// e.g `ufmt.`
+				cands := completionPackageIdent(s, pkgName.Imported(), tcr.pkg, true)
+				if cands == nil {
+					cands = completionPackageMembers(pkgName.Imported())
+				}
+				return reply(ctx, cc.rank(cands), nil)
+			}
 		}
-
-		m := mode(*tv)
-		if m != "var" {
+		tv, ok := tcr.info.Types[sel.X]
+		if !ok || tv.Type == nil || !tv.IsValue() {
 			return reply(ctx, nil, nil)
 		}
+		cands := completionMembers(tcr.pkg, tv.Type)
+		cands = append(cands, cc.postfixCandidates(sel, paths, pos, tcr)...)
+		return reply(ctx, cc.rank(cands), nil)
+	}
 
-		if strings.Contains(typeStr, pkg.ImportPath) { // local
-			t := parseType(typeStr, pkg.ImportPath)
-			methods, ok := pkg.Methods.Get(t)
-			if !ok {
-				return reply(ctx, nil, nil)
+	if lit, ok := paths[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		return reply(ctx, nil, nil)
+	}
+	kctx := keywordContextOf(paths)
+	if kctx == keywordTopLevel {
+		return reply(ctx, cc.rank(cc.keywordCandidates(kctx, f, paths, pos, tcr)), nil)
+	}
+	cands := completionScope(tcr, f, pos)
+	cands = append(cands, cc.keywordCandidates(kctx, f, paths, pos, tcr)...)
+	return reply(ctx, cc.rank(cands), nil)
+}
+
+// enclosingSelector returns the selector expression whose selector is
+// being typed at pos, e.g. `x.` or `x.Fo`.
+func enclosingSelector(paths []ast.Node, pos token.Pos) *ast.SelectorExpr {
+	for _, n := range paths {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			// cursor after the dot
+			if n.X.End() < pos && pos <= n.Sel.End() {
+				return n
 			}
-			items := []protocol.CompletionItem{}
-			for _, m := range methods {
-				items = append(items, protocol.CompletionItem{
-					Label:         m.Name,
-					InsertText:    m.Name + "()",
-					Kind:          protocol.CompletionItemKindFunction,
-					Detail:        m.Signature,
-					Documentation: m.Doc,
-				})
+			return nil
+		case *ast.Ident:
+			continue
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// completionPackageIdent returns the exported members of the package
+// imported, from the completion store. Call snippets take their
+// parameters from the type-checked package imported, as the store has
+// no arguments.
+func completionPackageIdent(s *server, imported, from *types.Package, includeFuncs bool) []candidate {
+	pkg := s.storePackage(imported.Path())
+	if pkg == nil {
+		return nil
+	}
+	cands := []candidate{}
+	if includeFuncs {
+		for _, f := range pkg.Functions {
+			if !f.IsExported() {
+				continue
 			}
-			return reply(ctx, items, nil)
-		}
-		// check imports
-		for _, spec := range pgf.File.Imports {
-			path := spec.Path.Value[1 : len(spec.Path.Value)-1]
-			if strings.Contains(typeStr, path) {
-				parts := strings.Split(path, "/")
-				last := parts[len(parts)-1]
-				pkg := s.completionStore.lookupPkg(last)
-				if pkg == nil {
-					break
-				}
-				t := parseType(typeStr, path)
-				methods, ok := pkg.Methods.Get(t)
-				if !ok {
-					break
-				}
-				items := []protocol.CompletionItem{}
-				for _, m := range methods {
-					items = append(items, protocol.CompletionItem{
-						Label:         m.Name,
-						InsertText:    m.Name + "()",
-						Kind:          protocol.CompletionItemKindFunction,
-						Detail:        m.Signature,
-						Documentation: m.Doc,
-					})
-				}
-				return reply(ctx, items, nil)
+			var params []string
+			if fn, ok := imported.Scope().Lookup(f.Name).(*types.Func); ok {
+				params = signatureParams(fn.Type().(*types.Signature), from)
 			}
+			cands = append(cands, candidate{
+				item: protocol.CompletionItem{
+					Label:      f.Name,
+					InsertText: f.Name + "()",
+					Kind:       protocol.CompletionItemKindFunction,
+				},
+				data:   &completionData{Store: true, Pkg: imported.Path(), Name: f.Name},
+				call:   true,
+				params: params,
+			})
 		}
-		return reply(ctx, nil, nil)
-	case *ast.CallExpr:
-		_, tv := getTypeAndValue(
-			*pgf.Fset,
-			pkg.TypeCheckResult.info, types.ExprString(n),
-			int(line),
-			offset,
-		)
-		if tv == nil || tv.Type == nil {
-			return reply(ctx, nil, nil)
+	}
+	for _, s := range pkg.Symbols {
+		if s.Kind == "func" {
+			continue
 		}
-		typeStr := tv.Type.String()
-		slog.Info(typeStr)
-		if strings.Contains(typeStr, pkg.ImportPath) { // local
-			t := parseType(typeStr, pkg.ImportPath)
-			methods, ok := pkg.Methods.Get(t)
-			if !ok {
-				return reply(ctx, nil, nil)
+		if !unicode.IsUpper(rune(s.Name[0])) {
+			continue
+		}
+		cands = append(cands, candidate{
+			item: protocol.CompletionItem{
+				Label:      s.Name,
+				InsertText: s.Name,
+				Kind:       symbolToKind(s.Kind),
+			},
+			data: &completionData{Store: true, Pkg: imported.Path(), Name: s.Name},
+		})
+	}
+	return cands
+}
+
+// completionPackageMembers returns the exported members of the
+// type-checked package pkg, used when pkg is not in the store.
+func completionPackageMembers(pkg *types.Package) []candidate {
+	cands := []candidate{}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		cands = append(cands, objectCandidate(obj, pkg))
+	}
+	return cands
+}
+
+// completionMembers returns the fields and methods of a value of type t,
+// including the promoted ones. from is the package being completed,
+// unexported members of other packages are skipped.
+func completionMembers(from *types.Package, t types.Type) []candidate {
+	cands := []candidate{}
+	seen := map[string]bool{}
+
+	// Members are resolved by looking them up in their named type.
+	var data *completionData
+	if named := namedOf(t); named != nil && named.Obj().Pkg() != nil {
+		data = &completionData{Pkg: named.Obj().Pkg().Path(), Recv: named.Obj().Name()}
+	}
+	member := func(obj types.Object) candidate {
+		cand := objectCandidate(obj, from)
+		if data != nil {
+			d := *data
+			d.Name = obj.Name()
+			cand.data = &d
+		}
+		return cand
+	}
+
+	for _, sel := range typeutil.IntuitiveMethodSet(t, nil) {
+		m := sel.Obj()
+		if seen[m.Name()] || !isAccessible(m, from) {
+			continue
+		}
+		seen[m.Name()] = true
+		cands = append(cands, member(m))
+	}
+
+	for _, f := range structFields(t) {
+		if seen[f.Name()] || !isAccessible(f, from) {
+			continue
+		}
+		seen[f.Name()] = true
+		cands = append(cands, member(f))
+	}
+	return cands
+}
+
+// structFields returns the fields of t (or *t) if it is a struct,
+// including fields promoted from embedded structs. Shallower fields
+// come first.
+func structFields(t types.Type) []*types.Var {
+	var res []*types.Var
+	seen := map[types.Type]bool{}
+	queue := []types.Type{t}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		if p, ok := t.Underlying().(*types.Pointer); ok {
+			t = p.Elem()
+		}
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			res = append(res, f)
+			if f.Embedded() {
+				queue = append(queue, f.Type())
 			}
-			items := []protocol.CompletionItem{}
-			for _, m := range methods {
-				items = append(items, protocol.CompletionItem{
-					Label:         m.Name,
-					InsertText:    m.Name + "()",
-					Kind:          protocol.CompletionItemKindFunction,
-					Detail:        m.Signature,
-					Documentation: m.Doc,
-				})
+		}
+	}
+	return res
+}
+
+// isAccessible reports whether obj can be referenced from the package from.
+func isAccessible(obj types.Object, from *types.Package) bool {
+	return obj.Exported() || obj.Pkg() == nil || obj.Pkg() == from
+}
+
+// completionScope returns the objects in scope at pos: locals and
+// params declared before pos, package-level declarations, imports and
+// builtins.
+func completionScope(tcr *TypeCheckResult, f *ast.File, pos token.Pos) []candidate {
+	cands := []candidate{}
+	if tcr.pkg == nil {
+		return cands
+	}
+
+	scope := tcr.pkg.Scope().Innermost(pos)
+	if scope == nil {
+		// Not in a function, start at the file scope.
+		scope = tcr.info.Scopes[f]
+	}
+	seen := map[string]bool{}
+	for ; scope != nil; scope = scope.Parent() {
+		isLocal := scope != tcr.pkg.Scope() &&
+			scope != types.Universe &&
+			scope.Parent() != tcr.pkg.Scope() // file scope
+		for _, name := range scope.Names() {
+			if name == "_" || seen[name] {
+				continue
 			}
-			return reply(ctx, items, nil)
-		}
-		// check imports
-		for _, spec := range pgf.File.Imports {
-			path := spec.Path.Value[1 : len(spec.Path.Value)-1]
-			if strings.Contains(typeStr, path) {
-				parts := strings.Split(path, "/")
-				last := parts[len(parts)-1]
-				pkg := s.completionStore.lookupPkg(last)
-				if pkg == nil {
-					break
-				}
-				t := parseType(typeStr, path)
-				methods, ok := pkg.Methods.Get(t)
-				if !ok {
-					break
-				}
-				items := []protocol.CompletionItem{}
-				for _, m := range methods {
-					items = append(items, protocol.CompletionItem{
-						Label:         m.Name,
-						InsertText:    m.Name + "()",
-						Kind:          protocol.CompletionItemKindFunction,
-						Detail:        m.Signature,
-						Documentation: m.Doc,
-					})
-				}
-				return reply(ctx, items, nil)
+			obj := scope.Lookup(name)
+			if isLocal && obj.Pos() > pos {
+				continue // declared after the cursor
 			}
+			seen[name] = true
+			cand := objectCandidate(obj, tcr.pkg)
+			cand.local = isLocal
+			cands = append(cands, cand)
 		}
-		return reply(ctx, nil, nil)
+	}
+
+	return cands
+}
+
+// objectItem returns the completion item of obj, qualifying types
+// relatively to the package from.
+func objectItem(obj types.Object, from *types.Package) protocol.CompletionItem {
+	item := protocol.CompletionItem{
+		Label:      obj.Name(),
+		InsertText: obj.Name(),
+		Kind:       objectKind(obj),
+		Detail:     types.ObjectString(obj, types.RelativeTo(from)),
+	}
+	switch obj := obj.(type) {
+	case *types.Func:
+		item.InsertText = obj.Name() + "()"
+	case *types.Builtin:
+		item.InsertText = obj.Name() + "()"
+		item.Detail = "builtin " + obj.Name()
+	case *types.PkgName:
+		item.Detail = fmt.Sprintf("package %s (%q)", obj.Name(), obj.Imported().Path())
+	}
+	return item
+}
+
+// objectCandidate returns the completion candidate of obj.
+// Package-level objects are resolved lazily.
+func objectCandidate(obj types.Object, from *types.Package) candidate {
+	cand := candidate{
+		item: objectItem(obj, from),
+		obj:  obj,
+	}
+	if obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope() {
+		cand.data = &completionData{Pkg: obj.Pkg().Path(), Name: obj.Name()}
+	}
+	switch obj := obj.(type) {
+	case *types.Func:
+		cand.call = true
+		cand.params = signatureParams(obj.Type().(*types.Signature), from)
+	case *types.Builtin:
+		cand.call = true
+	}
+	return cand
+}
+
+func objectKind(obj types.Object) protocol.CompletionItemKind {
+	switch obj := obj.(type) {
+	case *types.Var:
+		if obj.IsField() {
+			return protocol.CompletionItemKindField
+		}
+		return protocol.CompletionItemKindVariable
+	case *types.Const:
+		return protocol.CompletionItemKindConstant
+	case *types.Func:
+		if sig, ok := obj.Type().(*types.Signature); ok && sig.Recv() != nil {
+			return protocol.CompletionItemKindMethod
+		}
+		return protocol.CompletionItemKindFunction
+	case *types.Builtin:
+		return protocol.CompletionItemKindFunction
+	case *types.TypeName:
+		switch obj.Type().Underlying().(type) {
+		case *types.Struct:
+			return protocol.CompletionItemKindStruct
+		case *types.Interface:
+			return protocol.CompletionItemKindInterface
+		}
+		return protocol.CompletionItemKindClass
+	case *types.PkgName:
+		return protocol.CompletionItemKindModule
+	case *types.Nil:
+		return protocol.CompletionItemKindValue
 	default:
-		return reply(ctx, nil, nil)
+		return protocol.CompletionItemKindValue
 	}
 }
 
-func completionPackageIdent(ctx context.Context, s *server, reply jsonrpc2.Replier, params protocol.CompletionParams, pgf *ParsedGnoFile, i *ast.Ident, includeFuncs bool) error {
-	for _, spec := range pgf.File.Imports {
-		path := spec.Path.Value[1 : len(spec.Path.Value)-1]
-		parts := strings.Split(path, "/")
-		last := parts[len(parts)-1]
-		if last == i.Name {
-			pkg := s.completionStore.lookupPkg(last)
-			if pkg != nil {
-				items := []protocol.CompletionItem{}
-				if includeFuncs {
-					for _, f := range pkg.Functions {
-						if !f.IsExported() {
-							continue
-						}
-						items = append(items, protocol.CompletionItem{
-							Label:         f.Name,
-							InsertText:    f.Name + "()",
-							Kind:          protocol.CompletionItemKindFunction,
-							Detail:        f.Signature,
-							Documentation: f.Doc,
-						})
-					}
-				}
-				for _, s := range pkg.Symbols {
-					if s.Kind == "func" {
-						continue
-					}
-					if !unicode.IsUpper(rune(s.Name[0])) {
-						continue
-					}
-					items = append(items, protocol.CompletionItem{
-						Label:         s.Name,
-						InsertText:    s.Name,
-						Kind:          symbolToKind(s.Kind),
-						Detail:        s.Signature,
-						Documentation: s.Doc,
-					})
+// objectDoc returns the doc comment of obj, looking into pkg
+// if declared there, into the completion store otherwise.
+func (s *server) objectDoc(pkg *Package, obj types.Object) string {
+	if obj.Pkg() == nil {
+		return ""
+	}
+	p := pkg
+	if obj.Pkg().Path() != pkg.ImportPath {
+		p = s.storePackage(obj.Pkg().Path())
+	}
+	if p == nil {
+		return ""
+	}
+
+	if fn, ok := obj.(*types.Func); ok {
+		sig := fn.Type().(*types.Signature)
+		if sig.Recv() != nil {
+			recv := sig.Recv().Type()
+			if ptr, ok := recv.(*types.Pointer); ok {
+				recv = ptr.Elem()
+			}
+			named, ok := recv.(*types.Named)
+			if !ok {
+				return ""
+			}
+			methods, _ := p.Methods.Get(named.Obj().Name())
+			for _, m := range methods {
+				if m.Name == fn.Name() {
+					return m.Doc
 				}
-				return reply(ctx, items, nil)
 			}
+			return ""
 		}
 	}
 
-	return reply(ctx, nil, nil)
+	for _, s := range p.Symbols {
+		if s.Name == obj.Name() {
+			return s.Doc
+		}
+	}
+	return ""
 }
 
 // End
@@ -416,7 +592,11 @@ func PackageFromDir(path string, onlyExports bool) (*Package, error) {
 	if err != nil {
 		return nil, err
 	}
+	return packageFromFiles(path, filterGnoFiles(files, isPackageFile), onlyExports)
+}
 
+// packageFromFiles returns the Package made of files located in path.
+func packageFromFiles(path string, files []string, onlyExports bool) (*Package, error) {
 	gm, gmErr := gnomod.ParseAt(path)
 
 	var symbols []*Symbol
@@ -425,10 +605,6 @@ func PackageFromDir(path string, onlyExports bool) (*Package, error) {
 	var packageName string
 	methods := cmap.New[[]*Method]()
 	for _, fname := range files {
-		if strings.HasSuffix(fname, "_test.gno") ||
-			strings.HasSuffix(fname, "_filetest.gno") {
-			continue
-		}
 		absPath, err := filepath.Abs(fname)
 		if err != nil {
 			return nil, err
@@ -539,6 +715,7 @@ func PackageFromDir(path string, onlyExports bool) (*Package, error) {
 	}
 	return &Package{
 		Name: packageName,
+		Dir:  path,
 		ImportPath: func() string {
 			if gmErr != nil {
 				return packageName
@@ -0,0 +1,44 @@
+package lsp
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestCompletionPackageSameName(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/p/demo/avl/gno.mod":   "module gno.land/p/demo/avl\n",
+		"gno.land/p/demo/avl/avl.gno":   "package avl\n\n// Get gets.\nfunc Get() int { return 0 }\n",
+		"gno.land/p/demo/a/avl/gno.mod": "module gno.land/p/demo/a/avl\n",
+		"gno.land/p/demo/a/avl/avl.gno": "package avl\n\n// Other is another.\nfunc Other() int { return 0 }\n",
+		"gno.land/r/demo/foo/gno.mod":   "module gno.land/r/demo/foo\n",
+		"gno.land/r/demo/foo/foo.gno": `package foo
+
+import "gno.land/p/demo/avl"
+
+var x = avl./*use*/Get()
+`,
+	})
+	s.completionStore.Store(InitCompletionStore([]string{filepath.Join(s.env.GNOROOT, "examples", "gno.land", "p")}))
+
+	var items []protocol.CompletionItem
+	err := request(t, s, "textDocument/completion", protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: locs["use"].URI},
+			Position:     locs["use"].Range.Start,
+		},
+	}, &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	if got := strings.Join(labels, " "); got != "Get" {
+		t.Errorf("completions = %q, want Get", got)
+	}
+}
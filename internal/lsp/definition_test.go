@@ -0,0 +1,275 @@
+package lsp
+
+import (
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestDefinition(t *testing.T) {
+	const mod = "module gno.land/r/demo/foo\n"
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{
+			name: "local",
+			files: map[string]string{
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+func F() int {
+	/*def*/x := 1
+	return /*use*/x
+}
+`,
+			},
+		},
+		{
+			name: "shadowed local",
+			files: map[string]string{
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+func F() int {
+	x := 1
+	if true {
+		/*def*/x := 2
+		return /*use*/x
+	}
+	return x
+}
+`,
+			},
+		},
+		{
+			name: "param",
+			files: map[string]string{
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+func F(/*def*/n int) int {
+	return /*use*/n * 2
+}
+`,
+			},
+		},
+		{
+			name: "struct field",
+			files: map[string]string{
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+type T struct {
+	/*def*/N int
+}
+
+func F(t T) int {
+	return t./*use*/N
+}
+`,
+			},
+		},
+		{
+			name: "struct field in composite literal",
+			files: map[string]string{
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+type T struct {
+	/*def*/N int
+}
+
+var t = T{/*use*/N: 1}
+`,
+			},
+		},
+		{
+			name: "promoted field",
+			files: map[string]string{
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+type Base struct {
+	/*def*/ID int
+}
+
+type T struct {
+	Base
+}
+
+func F(t T) int {
+	return t./*use*/ID
+}
+`,
+			},
+		},
+		{
+			name: "embedded field",
+			files: map[string]string{
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+type /*def*/Base struct{}
+
+type T struct {
+	/*use*/Base
+}
+`,
+			},
+		},
+		{
+			name: "method on its receiver",
+			files: map[string]string{
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+type B struct{}
+
+func (B) M() {}
+
+type A struct{}
+
+func (A) /*def*/M() {}
+
+func F(a A, b B) {
+	b.M()
+	a./*use*/M()
+}
+`,
+			},
+		},
+		{
+			name: "promoted method",
+			files: map[string]string{
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+type Base struct{}
+
+func (*Base) /*def*/M() {}
+
+type T struct {
+	*Base
+}
+
+func (T) N() {}
+
+func F(t T) {
+	t./*use*/M()
+}
+`,
+			},
+		},
+		{
+			name: "label",
+			files: map[string]string{
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+func F() {
+/*def*/outer:
+	for {
+		for {
+			break /*use*/outer
+		}
+	}
+}
+`,
+			},
+		},
+		{
+			name: "other file",
+			files: map[string]string{
+				"gno.land/r/demo/foo/gno.mod": mod,
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+func F() int {
+	return /*use*/G()
+}
+`,
+				"gno.land/r/demo/foo/bar.gno": `package foo
+
+func /*def*/G() int { return 1 }
+`,
+			},
+		},
+		{
+			name: "package-qualified",
+			files: map[string]string{
+				"gno.land/r/demo/foo/gno.mod": mod,
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+import "gno.land/p/demo/bar"
+
+func F() string {
+	return bar./*use*/Hello()
+}
+`,
+				"gno.land/p/demo/bar/gno.mod": "module gno.land/p/demo/bar\n",
+				"gno.land/p/demo/bar/bar.gno": `package bar
+
+func /*def*/Hello() string { return "hello" }
+`,
+			},
+		},
+		{
+			name: "package-qualified type",
+			files: map[string]string{
+				"gno.land/r/demo/foo/gno.mod": mod,
+				"gno.land/r/demo/foo/foo.gno": `package foo
+
+import "gno.land/p/demo/bar"
+
+var b bar./*use*/Bar
+`,
+				"gno.land/p/demo/bar/gno.mod": "module gno.land/p/demo/bar\n",
+				"gno.land/p/demo/bar/bar.gno": `package bar
+
+type /*def*/Bar struct{}
+`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, locs := testServer(t, tt.files)
+			use, def := locs["use"], locs["def"]
+
+			var got *protocol.Location
+			err := request(t, s, "textDocument/definition", protocol.DefinitionParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: use.URI},
+					Position:     use.Range.Start,
+				},
+			}, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil {
+				t.Fatal("no definition")
+			}
+			if got.URI != def.URI || got.Range.Start != def.Range.Start {
+				t.Errorf("definition = %s:%d:%d, want %s:%d:%d",
+					got.URI.Filename(), got.Range.Start.Line+1, got.Range.Start.Character+1,
+					def.URI.Filename(), def.Range.Start.Line+1, def.Range.Start.Character+1)
+			}
+		})
+	}
+}
+
+func TestDefinitionNone(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/r/demo/foo/foo.gno": `package foo
+
+func F() int {
+	return /*use*/len("builtin")
+}
+`,
+	})
+	use := locs["use"]
+	var got *protocol.Location
+	err := request(t, s, "textDocument/definition", protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: use.URI},
+			Position:     use.Range.Start,
+		},
+	}, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("definition = %+v, want none", got)
+	}
+}
@@ -2,72 +2,295 @@ package lsp
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"os"
 	"path/filepath"
-	"strings"
+	"reflect"
+	"sort"
 
+	cmap "github.com/orcaman/concurrent-map/v2"
 	"go.lsp.dev/jsonrpc2"
 	"go.lsp.dev/protocol"
 )
 
+// publishDiagnostics builds the package of file and publishes the
+// diagnostics of each of its files, then does the same for the packages
+// of the Cache depending on it. Files whose diagnostics were published
+// and which became clean, or were removed, are cleared. If the client
+// pulls diagnostics, it is asked to pull them again instead, when the
+// build errors changed.
 func (s *server) publishDiagnostics(ctx context.Context, conn jsonrpc2.Conn, file *GnoFile) error {
 	slog.Info("Lint", "path", file.URI.Filename())
 
-	errors, err := s.TranspileAndBuild(file)
+	dir := filepath.Dir(file.URI.Filename())
+	dirs := []string{dir}
+	if pkg, ok := s.cache.pkgs.Get(dir); ok && pkg.ImportPath != "" {
+		dirs = append(dirs, s.dependents(pkg.ImportPath)...)
+	}
+	changed := false
+	for i, d := range dirs {
+		if i > 0 {
+			// The package of file is up to date already
+			s.UpdateCache(d)
+		}
+		errors, err := s.TranspileAndBuild(d)
+		if err != nil {
+			return err
+		}
+		previous, _ := s.buildErrors.Get(d)
+		changed = changed || !reflect.DeepEqual(previous, errors)
+		s.buildErrors.Set(d, errors)
+		if err := s.publishPackageDiagnostics(ctx, conn, d); err != nil {
+			return err
+		}
+	}
+	if changed {
+		s.refreshDiagnostics(ctx, conn)
+	}
+	return nil
+}
+
+// refreshDiagnostics asks the client to pull diagnostics again, if it
+// pulls them and supports it.
+func (s *server) refreshDiagnostics(ctx context.Context, conn jsonrpc2.Conn) {
+	if !s.pullDiagnostics() || !s.diagnosticRefreshSupport() {
+		return
+	}
+	// Not waiting for the response in the handler of a request
+	go func() {
+		if _, err := conn.Call(context.WithoutCancel(ctx), "workspace/diagnostic/refresh", nil, nil); err != nil {
+			slog.Error("diagnostic refresh", "err", err)
+		}
+	}()
+}
+
+// dependents returns the directories of the packages of the Cache
+// importing the package importPath, directly or not.
+func (s *server) dependents(importPath string) []string {
+	imports := func(pkg *Package, path string) bool {
+		if pkg.TypeCheckResult == nil || pkg.TypeCheckResult.pkg == nil {
+			return false
+		}
+		for _, imp := range pkg.TypeCheckResult.pkg.Imports() {
+			if imp.Path() == path {
+				return true
+			}
+		}
+		return false
+	}
+
+	dirs := []string{}
+	seen := map[string]bool{}
+	for dir, pkg := range s.cache.pkgs.Items() {
+		if pkg.ImportPath == importPath {
+			seen[dir] = true
+		}
+	}
+	queue := []string{importPath}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		keys := s.cache.pkgs.Keys()
+		sort.Strings(keys)
+		for _, dir := range keys {
+			pkg, ok := s.cache.pkgs.Get(dir)
+			if !ok || seen[dir] || !imports(pkg, path) {
+				continue
+			}
+			seen[dir] = true
+			dirs = append(dirs, dir)
+			queue = append(queue, pkg.ImportPath)
+		}
+		// Tests and filetests aren't imported, they only add their dir
+		for _, m := range []cmap.ConcurrentMap[string, *Package]{s.cache.tests, s.cache.filetests} {
+			for filename, pkg := range m.Items() {
+				dir := filepath.Dir(filename)
+				if seen[dir] || !imports(pkg, path) {
+					continue
+				}
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// publishPackageDiagnostics publishes the diagnostics of each file of the
+// package dir, keyed by their absolute path. Files without diagnostics are
+// only published to clear the previous ones. Nothing is published if the
+// client pulls diagnostics.
+func (s *server) publishPackageDiagnostics(ctx context.Context, conn jsonrpc2.Conn, dir string) error {
+	if s.pullDiagnostics() {
+		return nil
+	}
+	files, err := ListGnoFiles(dir)
 	if err != nil {
 		return err
 	}
-	pkg, ok := s.cache.pkgs.Get(filepath.Dir(string(file.URI.Filename())))
-	if ok {
-		errs := pkg.TypeCheckResult.Errors()
-		if errs != nil {
-			errors = append(errors, errs...)
+	current := map[string]bool{}
+	for _, filename := range files {
+		current[filename] = true
+	}
+	// Clear removed files
+	for _, filename := range s.diagnosedFiles.Keys() {
+		if filepath.Dir(filename) == dir && !current[filename] {
+			files = append(files, filename)
 		}
 	}
 
-	mPublishDiagnosticParams := make(map[string]*protocol.PublishDiagnosticsParams)
-	publishDiagnosticParams := make([]*protocol.PublishDiagnosticsParams, 0)
-	for _, er := range errors {
-		if !strings.HasSuffix(file.URI.Filename(), er.FileName) {
-			continue
+	for _, filename := range files {
+		diagnostics := []protocol.Diagnostic{}
+		if current[filename] {
+			diagnostics = s.fileDiagnostics(ctx, filename)
 		}
-		diagnostic := protocol.Diagnostic{
-			Range:    *posToRange(er.Line, er.Span),
-			Severity: protocol.DiagnosticSeverityError,
-			Source:   "gnopls",
-			Message:  er.Msg,
-			Code:     er.Tool,
+		if len(diagnostics) == 0 {
+			if _, ok := s.diagnosedFiles.Get(filename); !ok {
+				continue
+			}
+			s.diagnosedFiles.Remove(filename)
+		} else {
+			s.diagnosedFiles.Set(filename, true)
 		}
-		if pdp, ok := mPublishDiagnosticParams[er.FileName]; ok {
-			pdp.Diagnostics = append(pdp.Diagnostics, diagnostic)
-			continue
+		err := conn.Notify(ctx, protocol.MethodTextDocumentPublishDiagnostics, &protocol.PublishDiagnosticsParams{
+			URI:         getURI(filename),
+			Diagnostics: diagnostics,
+		})
+		if err != nil {
+			return err
 		}
-		publishDiagnosticParam := protocol.PublishDiagnosticsParams{
-			URI:         file.URI,
-			Diagnostics: []protocol.Diagnostic{diagnostic},
+	}
+	return nil
+}
+
+// errorDiagnostic converts er to a protocol.Diagnostic.
+func errorDiagnostic(er ErrorInfo) protocol.Diagnostic {
+	return protocol.Diagnostic{
+		Range:    *posToRange(er.Line, er.Span),
+		Severity: protocol.DiagnosticSeverityError,
+		Source:   "gnopls",
+		Message:  er.Msg,
+		Code:     er.Tool,
+	}
+}
+
+// fileDiagnostics returns the diagnostics of the file filename: the
+// errors of the latest build of its package, of its type-check using
+// its unsaved content, of its filetest directives, and the failures of
+// the latest test run of its package.
+func (s *server) fileDiagnostics(ctx context.Context, filename string) []protocol.Diagnostic {
+	dir := filepath.Dir(filename)
+	build, _ := s.buildErrors.Get(dir)
+	failures, _ := s.testFailures.Get(dir)
+	errors := append(append([]ErrorInfo{}, build...), failures...)
+
+	file, ok := s.snapshot.Get(filename)
+	if !ok {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return []protocol.Diagnostic{}
+		}
+		file = &GnoFile{URI: getURI(filename), Src: src}
+	}
+	if ok {
+		if tcr, ok := s.typeCheckFile(file); ok {
+			errors = append(errors, tcr.Errors()...)
+		}
+	} else if pkg, ok := s.cache.lookupPackage(filename); ok && pkg.TypeCheckResult != nil {
+		// Same content as the cached package
+		errors = append(errors, pkg.TypeCheckResult.Errors()...)
+	}
+	if isFiletest(filename) {
+		if pgf, err := file.ParseGno2(ctx); err == nil {
+			errors = append(errors, directiveErrors(pgf)...)
 		}
-		publishDiagnosticParams = append(publishDiagnosticParams, &publishDiagnosticParam)
-		mPublishDiagnosticParams[er.FileName] = &publishDiagnosticParam
 	}
 
-	// Clean old diagnosed errors if no error found for current file
-	found := false
+	diagnostics := []protocol.Diagnostic{}
+	seen := map[string]bool{}
 	for _, er := range errors {
-		if strings.HasSuffix(er.FileName, filepath.Base(file.URI.Filename())) {
-			found = true
-			break
+		if er.FileName != filename {
+			continue
+		}
+		// Build and type-check often report the same error
+		key := fmt.Sprintf("%d:%s", er.Line, er.Msg)
+		if seen[key] {
+			continue
 		}
+		seen[key] = true
+		diagnostics = append(diagnostics, errorDiagnostic(er))
 	}
-	if !found {
-		publishDiagnosticParams = append(publishDiagnosticParams, &protocol.PublishDiagnosticsParams{
-			URI:         file.URI,
-			Diagnostics: []protocol.Diagnostic{},
-		})
+	return diagnostics
+}
+
+// diagnosticsResultID identifies diagnostics in pull diagnostics reports.
+func diagnosticsResultID(diagnostics []protocol.Diagnostic) string {
+	b, _ := json.Marshal(diagnostics)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// documentDiagnosticReport returns the report of the diagnostics of
+// filename, unchanged if their result ID is previousID.
+func (s *server) documentDiagnosticReport(ctx context.Context, filename, previousID string) (full *fullDocumentDiagnosticReport, unchanged *unchangedDocumentDiagnosticReport) {
+	diagnostics := s.fileDiagnostics(ctx, filename)
+	id := diagnosticsResultID(diagnostics)
+	if id == previousID {
+		return nil, &unchangedDocumentDiagnosticReport{Kind: unchangedDiagnosticReport, ResultID: id}
+	}
+	return &fullDocumentDiagnosticReport{Kind: fullDiagnosticReport, ResultID: id, Items: diagnostics}, nil
+}
+
+func (s *server) DocumentDiagnostic(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params documentDiagnosticParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	full, unchanged := s.documentDiagnosticReport(ctx, params.TextDocument.URI.Filename(), params.PreviousResultID)
+	if unchanged != nil {
+		return reply(ctx, unchanged, nil)
 	}
+	return reply(ctx, full, nil)
+}
 
-	return conn.Notify(
-		ctx,
-		protocol.MethodTextDocumentPublishDiagnostics,
-		publishDiagnosticParams,
-	)
+func (s *server) WorkspaceDiagnostic(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params workspaceDiagnosticParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+	previous := map[string]string{}
+	for _, p := range params.PreviousResultIDs {
+		previous[p.URI.Filename()] = p.Value
+	}
+
+	dirs := s.cache.pkgs.Keys()
+	sort.Strings(dirs)
+	report := workspaceDiagnosticReport{Items: []interface{}{}}
+	for _, dir := range dirs {
+		files, err := ListGnoFiles(dir)
+		if err != nil {
+			continue
+		}
+		for _, filename := range files {
+			uri := getURI(filename)
+			full, unchanged := s.documentDiagnosticReport(ctx, filename, previous[filename])
+			if unchanged != nil {
+				report.Items = append(report.Items, workspaceUnchangedDocumentDiagnosticReport{
+					unchangedDocumentDiagnosticReport: *unchanged,
+					URI:                               uri,
+				})
+				continue
+			}
+			report.Items = append(report.Items, workspaceFullDocumentDiagnosticReport{
+				fullDocumentDiagnosticReport: *full,
+				URI:                          uri,
+			})
+		}
+	}
+	return reply(ctx, report, nil)
 }
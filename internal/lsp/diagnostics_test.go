@@ -0,0 +1,128 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+)
+
+// recordingConn is a client connection recording the methods of the
+// messages sent to it.
+type recordingConn struct {
+	nopConn
+	mu      sync.Mutex
+	methods []string
+	called  chan string
+}
+
+func (c *recordingConn) Notify(_ context.Context, method string, _ interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.methods = append(c.methods, method)
+	return nil
+}
+
+func (c *recordingConn) Call(ctx context.Context, method string, params, res interface{}) (jsonrpc2.ID, error) {
+	c.called <- method
+	return c.nopConn.Call(ctx, method, params, res)
+}
+
+func TestPullDiagnostics(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities string
+		publish      bool
+		refresh      bool
+	}{
+		{name: "push", capabilities: `{}`, publish: true},
+		{name: "pull", capabilities: `{"textDocument": {"diagnostic": {}}}`},
+		{
+			name:         "pull with refresh",
+			capabilities: `{"textDocument": {"diagnostic": {}}, "workspace": {"diagnostics": {"refreshSupport": true}}}`,
+			refresh:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, locs := testServer(t, map[string]string{
+				"gno.land/r/demo/foo/foo.gno": "package foo\n\nvar /*x*/x int = \"\"\n",
+			})
+			var res any
+			params := json.RawMessage(`{"capabilities": ` + tt.capabilities + `}`)
+			if err := request(t, s, "initialize", params, &res); err != nil {
+				t.Fatal(err)
+			}
+
+			conn := &recordingConn{called: make(chan string, 1)}
+			file, _ := s.snapshot.Get(locs["x"].URI.Filename())
+			if err := s.publishDiagnostics(context.Background(), conn, file); err != nil {
+				t.Fatal(err)
+			}
+			published := len(conn.methods) > 0
+			if published != tt.publish {
+				t.Errorf("published = %v, want %v", published, tt.publish)
+			}
+			select {
+			case method := <-conn.called:
+				if !tt.refresh || method != "workspace/diagnostic/refresh" {
+					t.Errorf("unexpected call %s", method)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.refresh {
+					t.Error("no refresh")
+				}
+			}
+		})
+	}
+}
+
+func TestFileDiagnosticsFileName(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/r/demo/foo/foo.gno": "package /*foo*/foo\n\nvar x = 1\n",
+	})
+	filename := locs["foo"].URI.Filename()
+	dir := filepath.Dir(filename)
+	output := "foo.gno:3:5: x declared and not used\n"
+	errors, err := parseErrors(dir, output, "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same name in another package
+	other, err := parseErrors(filepath.Join(dir, "..", "bar"), "foo.gno:1:1: undefined: y\n", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.buildErrors.Set(dir, append(errors, other...))
+
+	diagnostics := s.fileDiagnostics(context.Background(), filename)
+	if len(diagnostics) != 1 || diagnostics[0].Range.Start.Line != 2 {
+		t.Errorf("diagnostics = %+v, want one on line 3", diagnostics)
+	}
+}
+
+// Test failures are published from the goroutine running the tests,
+// while requests are handled.
+func TestFileDiagnosticsConcurrent(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/p/demo/bar/bar.gno": "package bar\n\nfunc Hello() string { return \"hello\" }\n",
+		"gno.land/r/demo/foo/foo.gno": "package /*foo*/foo\n",
+	})
+	filename := locs["foo"].URI.Filename()
+	// The unsaved content imports a package the saved one doesn't
+	src := "package foo\n\nimport \"gno.land/p/demo/bar\"\n\nvar x string = bar.Hello()\n"
+	s.snapshot.file.Set(filename, &GnoFile{URI: getURI(filename), Src: []byte(src)})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.fileDiagnostics(context.Background(), filename)
+		}()
+	}
+	wg.Wait()
+}
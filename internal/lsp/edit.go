@@ -0,0 +1,143 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"path"
+	"strconv"
+
+	"github.com/harry-hov/gnopls/internal/tools"
+
+	"go.lsp.dev/protocol"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// applyEdit asks the client to apply edit with `workspace/applyEdit`.
+// Note: it must not be called from the request handler itself, as it
+// waits for the client to answer.
+func (s *server) applyEdit(ctx context.Context, label string, edit protocol.WorkspaceEdit) error {
+	return s.callApplyEdit(ctx, protocol.ApplyWorkspaceEditParams{
+		Label: label,
+		Edit:  edit,
+	})
+}
+
+// applyDocumentChanges is applyEdit for edits with resource operations.
+func (s *server) applyDocumentChanges(ctx context.Context, label string, edit workspaceEdit) error {
+	return s.callApplyEdit(ctx, applyWorkspaceEditParams{
+		Label: label,
+		Edit:  edit,
+	})
+}
+
+func (s *server) callApplyEdit(ctx context.Context, params interface{}) error {
+	var res protocol.ApplyWorkspaceEditResponse
+	_, err := s.conn.Call(ctx, protocol.MethodWorkspaceApplyEdit, params, &res)
+	if err != nil {
+		return err
+	}
+	if !res.Applied {
+		if res.FailureReason != "" {
+			return errors.New(res.FailureReason)
+		}
+		return errors.New("edit not applied")
+	}
+	return nil
+}
+
+// formattedEdit returns the edit replacing the content of uri with the
+// formatted src.
+func (s *server) formattedEdit(uri protocol.DocumentURI, src []byte) (*protocol.WorkspaceEdit, error) {
+	formatted, err := tools.Format(string(src), s.formatOpt)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.WorkspaceEdit{
+		Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+			uri: {replaceAll(formatted)},
+		},
+	}, nil
+}
+
+// replaceAll returns the edit replacing the whole content of a file
+// with text.
+func replaceAll(text []byte) protocol.TextEdit {
+	return protocol.TextEdit{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: 0, Character: 0},
+			End: protocol.Position{
+				Line:      math.MaxInt32,
+				Character: math.MaxInt32,
+			},
+		},
+		NewText: string(text),
+	}
+}
+
+// fileImports qualifies the packages referenced by source generated in
+// the file f of pkg, with the names f imports them as. The packages f
+// doesn't import yet are recorded to be added with addImports.
+type fileImports struct {
+	pkg     *types.Package
+	f       *ast.File
+	missing map[string]string // path -> name
+}
+
+func newFileImports(pkg *types.Package, f *ast.File) *fileImports {
+	return &fileImports{pkg: pkg, f: f, missing: map[string]string{}}
+}
+
+// qualifier is a types.Qualifier.
+func (fi *fileImports) qualifier(p *types.Package) string {
+	if p == fi.pkg {
+		return ""
+	}
+	for _, spec := range fi.f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || path != p.Path() {
+			continue
+		}
+		if spec.Name == nil {
+			return p.Name()
+		}
+		switch spec.Name.Name {
+		case "_":
+			continue
+		case ".":
+			return ""
+		}
+		return spec.Name.Name
+	}
+	fi.missing[p.Path()] = p.Name()
+	return p.Name()
+}
+
+// addImports returns src with the missing imports of fi added.
+func (fi *fileImports) addImports(src []byte) ([]byte, error) {
+	if len(fi.missing) == 0 {
+		return src, nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for importPath, name := range fi.missing {
+		if name == path.Base(importPath) {
+			name = ""
+		}
+		astutil.AddNamedImport(fset, f, name, importPath)
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,619 @@
+package lsp
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// refactoring is a selection of a type-checked file to be refactored.
+type refactoring struct {
+	tcr        *TypeCheckResult
+	f          *ast.File
+	tf         *token.File
+	src        []byte
+	start, end token.Pos
+}
+
+// codeActionsExtract returns the `refactor.extract` code actions
+// available for the selection rng of file.
+func (s *server) codeActionsExtract(file *GnoFile, rng protocol.Range) []protocol.CodeAction {
+	if rng.Start == rng.End {
+		return nil
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil
+	}
+	f, tf := tcr.file(filepath.Base(file.URI.Filename()))
+	if f == nil {
+		return nil
+	}
+	start, end := posFromPosition(tf, rng.Start), posFromPosition(tf, rng.End)
+	if !start.IsValid() || !end.IsValid() {
+		return nil
+	}
+	rf := &refactoring{tcr: tcr, f: f, tf: tf, src: file.Src}
+	rf.start, rf.end = rf.trimSpace(start, end)
+	if rf.start >= rf.end {
+		return nil
+	}
+
+	actions := []protocol.CodeAction{}
+	add := func(title string, src []byte) {
+		edit, err := s.formattedEdit(file.URI, src)
+		if err != nil {
+			return
+		}
+		actions = append(actions, protocol.CodeAction{
+			Title: title,
+			Kind:  protocol.RefactorExtract,
+			Edit:  edit,
+		})
+	}
+	if src, ok := rf.function(); ok {
+		add("Extract function", src)
+	}
+	if src, ok := rf.variable(); ok {
+		add("Extract variable", src)
+	}
+	if src, ok := rf.constant(); ok {
+		add("Extract constant", src)
+	}
+	return actions
+}
+
+// trimSpace excludes the leading and trailing whitespaces of [start, end).
+func (rf *refactoring) trimSpace(start, end token.Pos) (token.Pos, token.Pos) {
+	so, eo := rf.offset(start), rf.offset(end)
+	for so < eo && isSpace(rf.src[so]) {
+		so++
+	}
+	for eo > so && isSpace(rf.src[eo-1]) {
+		eo--
+	}
+	return rf.tf.Pos(so), rf.tf.Pos(eo)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func (rf *refactoring) offset(pos token.Pos) int {
+	return rf.tf.Offset(pos)
+}
+
+// text returns the source of [pos, end).
+func (rf *refactoring) text(pos, end token.Pos) string {
+	return string(rf.src[rf.offset(pos):rf.offset(end)])
+}
+
+// splice returns the source with [pos, end) replaced by the text of
+// each replacement, which must be ordered and must not overlap.
+func (rf *refactoring) splice(replacements ...replacement) []byte {
+	var b strings.Builder
+	last := 0
+	for _, r := range replacements {
+		b.Write(rf.src[last:rf.offset(r.pos)])
+		b.WriteString(r.text)
+		last = rf.offset(r.end)
+	}
+	b.Write(rf.src[last:])
+	return []byte(b.String())
+}
+
+type replacement struct {
+	pos, end token.Pos
+	text     string
+}
+
+// freeName returns base, suffixed with a number if needed so that it
+// doesn't conflict with the objects in scope at pos.
+func (rf *refactoring) freeName(base string, pos token.Pos) string {
+	scope := rf.tcr.pkg.Scope().Innermost(pos)
+	if scope == nil {
+		scope = rf.tcr.pkg.Scope()
+	}
+	name := base
+	for i := 1; ; i++ {
+		if _, obj := scope.LookupParent(name, token.NoPos); obj == nil {
+			return name
+		}
+		name = base + strconv.Itoa(i)
+	}
+}
+
+// function returns the source with the selected statements extracted
+// into a new function. The variables used by the statements become its
+// parameters, and the ones they assign and that are used afterwards
+// become its results.
+func (rf *refactoring) function() ([]byte, bool) {
+	path, _ := astutil.PathEnclosingInterval(rf.f, rf.start, rf.end)
+	var stmts []ast.Stmt
+	var decl *ast.FuncDecl
+	for _, n := range path {
+		if list, ok := stmtList(n); ok && stmts == nil {
+			if stmts, ok = selectedStmts(list, rf.start, rf.end); !ok {
+				return nil, false
+			}
+		}
+		if d, ok := n.(*ast.FuncDecl); ok {
+			decl = d
+		}
+	}
+	if decl == nil || len(stmts) == 0 || !extractableStmts(stmts) {
+		return nil, false
+	}
+	start, end := stmts[0].Pos(), stmts[len(stmts)-1].End()
+	info := rf.tcr.info
+
+	// Parameters are the variables of the function declared before the
+	// selection. Their order is the order of first use.
+	inDecl := func(v *types.Var) bool { return decl.Pos() <= v.Pos() && v.Pos() < decl.End() }
+	inSel := func(pos token.Pos) bool { return start <= pos && pos < end }
+	var params, defined []*types.Var
+	isParam := map[*types.Var]bool{}
+	nodes := make([]ast.Node, len(stmts))
+	for i, stmt := range stmts {
+		nodes[i] = stmt
+	}
+	isWritten := mutatedVars(info, nodes...)
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if v, ok := info.Defs[id].(*types.Var); ok && !v.IsField() {
+				defined = append(defined, v)
+			}
+			v, ok := info.Uses[id].(*types.Var)
+			if !ok || v.IsField() || !inDecl(v) || inSel(v.Pos()) {
+				return true
+			}
+			if !isParam[v] {
+				isParam[v] = true
+				params = append(params, v)
+			}
+			return true
+		})
+	}
+
+	// Results are the variables modified by the selection and used after,
+	// including in place, e.g. `x.f = 1`, as parameters are copies.
+	// In a loop, the variables declared outside are also used in the next
+	// iterations.
+	usedAfter := map[types.Object]bool{}
+	for id, obj := range info.Uses {
+		if end <= id.Pos() && id.Pos() < decl.End() {
+			usedAfter[obj] = true
+		}
+	}
+	for _, n := range path {
+		switch n.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			for id, obj := range info.Uses {
+				if n.Pos() <= id.Pos() && id.Pos() < n.End() && obj.Pos() < n.Pos() {
+					usedAfter[obj] = true
+				}
+			}
+		}
+	}
+	var results, newResults []*types.Var
+	for _, v := range params {
+		if isWritten[v] && usedAfter[v] {
+			results = append(results, v)
+		}
+	}
+	for _, v := range defined {
+		if usedAfter[v] {
+			newResults = append(newResults, v)
+		}
+	}
+
+	qf := types.RelativeTo(rf.tcr.pkg)
+	name := rf.freeName("newFunction", start)
+	var args, paramDecls []string
+	for _, v := range params {
+		args = append(args, v.Name())
+		paramDecls = append(paramDecls, v.Name()+" "+types.TypeString(v.Type(), qf))
+	}
+	var resNames, resTypes []string
+	for _, v := range append(results, newResults...) {
+		resNames = append(resNames, v.Name())
+		resTypes = append(resTypes, types.TypeString(v.Type(), qf))
+	}
+
+	call := name + "(" + strings.Join(args, ", ") + ")"
+	switch {
+	case len(resNames) == 0:
+	case len(newResults) == 0:
+		call = strings.Join(resNames, ", ") + " = " + call
+	case len(results) == 0:
+		call = strings.Join(resNames, ", ") + " := " + call
+	default:
+		// Declare the new variables, as `:=` would shadow the others
+		var decls string
+		for _, v := range newResults {
+			decls += "var " + v.Name() + " " + types.TypeString(v.Type(), qf) + "\n"
+		}
+		call = decls + strings.Join(resNames, ", ") + " = " + call
+	}
+
+	body := rf.text(start, end)
+	if len(resNames) > 0 {
+		body += "\nreturn " + strings.Join(resNames, ", ")
+	}
+	var resultList string
+	switch len(resTypes) {
+	case 0:
+	case 1:
+		resultList = " " + resTypes[0]
+	default:
+		resultList = " (" + strings.Join(resTypes, ", ") + ")"
+	}
+	fn := "\n\nfunc " + name + "(" + strings.Join(paramDecls, ", ") + ")" + resultList + " {\n" + body + "\n}"
+
+	return rf.splice(
+		replacement{start, end, call},
+		replacement{decl.End(), decl.End(), fn},
+	), true
+}
+
+// mutatedVars returns the variables whose value is modified in place
+// by nodes: assigned, incremented, having a field or an array element
+// written or its address taken, or a method with a pointer receiver
+// called.
+func mutatedVars(info *types.Info, nodes ...ast.Node) map[*types.Var]bool {
+	mutated := map[*types.Var]bool{}
+	add := func(e ast.Expr) {
+		if v := storageVar(info, e); v != nil {
+			mutated[v] = true
+		}
+	}
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				// Variables defined by `:=` aren't in Uses
+				for _, lhs := range n.Lhs {
+					add(lhs)
+				}
+			case *ast.IncDecStmt:
+				add(n.X)
+			case *ast.RangeStmt:
+				if n.Tok == token.ASSIGN {
+					if n.Key != nil {
+						add(n.Key)
+					}
+					if n.Value != nil {
+						add(n.Value)
+					}
+				}
+			case *ast.UnaryExpr:
+				if n.Op == token.AND {
+					add(n.X)
+				}
+			case *ast.SelectorExpr:
+				// Method values and calls take the address of x in
+				// `x.M` if M has a pointer receiver.
+				sel, ok := info.Selections[n]
+				if !ok || sel.Kind() != types.MethodVal || sel.Indirect() {
+					break
+				}
+				recv := sel.Obj().Type().(*types.Signature).Recv()
+				if _, ptr := recv.Type().(*types.Pointer); !ptr {
+					break
+				}
+				if _, ptr := info.TypeOf(n.X).Underlying().(*types.Pointer); !ptr {
+					add(n.X)
+				}
+			}
+			return true
+		})
+	}
+	return mutated
+}
+
+// storageVar returns the variable holding the storage written through
+// e: x for `x`, and for `x.f` or `x[i]` when x is a struct or an array.
+// Writing through a pointer, a slice or a map doesn't modify the
+// variable.
+func storageVar(info *types.Info, e ast.Expr) *types.Var {
+	for {
+		switch x := astutil.Unparen(e).(type) {
+		case *ast.Ident:
+			v, _ := info.Uses[x].(*types.Var)
+			return v
+		case *ast.SelectorExpr:
+			sel, ok := info.Selections[x]
+			if !ok || sel.Kind() != types.FieldVal || sel.Indirect() {
+				return nil
+			}
+			e = x.X
+		case *ast.IndexExpr:
+			t := info.TypeOf(x.X)
+			if t == nil {
+				return nil
+			}
+			if _, ok := t.Underlying().(*types.Array); !ok {
+				return nil
+			}
+			e = x.X
+		default:
+			return nil
+		}
+	}
+}
+
+// stmtList returns the statements of the block n.
+func stmtList(n ast.Node) ([]ast.Stmt, bool) {
+	switch n := n.(type) {
+	case *ast.BlockStmt:
+		return n.List, true
+	case *ast.CaseClause:
+		return n.Body, true
+	case *ast.CommClause:
+		return n.Body, true
+	}
+	return nil, false
+}
+
+// selectedStmts returns the statements of list within [start, end). It
+// fails if a statement is partially selected, or if list contains the
+// clauses of a switch or select.
+func selectedStmts(list []ast.Stmt, start, end token.Pos) ([]ast.Stmt, bool) {
+	var res []ast.Stmt
+	for _, stmt := range list {
+		if stmt.End() <= start || end <= stmt.Pos() {
+			continue
+		}
+		if stmt.Pos() < start || end < stmt.End() || isClause(stmt) {
+			return nil, false
+		}
+		res = append(res, stmt)
+	}
+	return res, len(res) > 0
+}
+
+// extractableStmts reports whether stmts can be moved into another
+// function: they must not return, defer, or branch outside of them.
+func extractableStmts(stmts []ast.Stmt) bool {
+	ok := true
+	for _, stmt := range stmts {
+		var stack []ast.Node
+		within := func(match func(ast.Node) bool) bool {
+			for _, n := range stack {
+				if match(n) {
+					return true
+				}
+			}
+			return false
+		}
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false // own control flow
+			case *ast.ReturnStmt, *ast.DeferStmt:
+				ok = false
+			case *ast.BranchStmt:
+				switch {
+				case n.Label != nil, n.Tok == token.GOTO, n.Tok == token.FALLTHROUGH:
+					ok = false
+				case n.Tok == token.CONTINUE && !within(isLoop):
+					ok = false
+				case n.Tok == token.BREAK && !within(isBreakable):
+					ok = false
+				}
+			}
+			stack = append(stack, n)
+			return true
+		})
+	}
+	return ok
+}
+
+func isLoop(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.ForStmt, *ast.RangeStmt:
+		return true
+	}
+	return false
+}
+
+func isBreakable(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		return true
+	}
+	return isLoop(n)
+}
+
+// selectedExpr returns the expression exactly selected, with the path
+// of nodes enclosing it. Identifiers are not extracted.
+func (rf *refactoring) selectedExpr() (ast.Expr, []ast.Node, bool) {
+	path, _ := astutil.PathEnclosingInterval(rf.f, rf.start, rf.end)
+	if len(path) < 2 || path[0].Pos() != rf.start || path[0].End() != rf.end {
+		return nil, nil, false
+	}
+	expr, ok := path[0].(ast.Expr)
+	if !ok {
+		return nil, nil, false
+	}
+	if _, ok := expr.(*ast.Ident); ok {
+		return nil, nil, false
+	}
+	tv, ok := rf.tcr.info.Types[expr]
+	if !ok || tv.IsType() || tv.IsVoid() || tv.Type == nil {
+		return nil, nil, false
+	}
+	if _, ok := tv.Type.(*types.Tuple); ok {
+		return nil, nil, false
+	}
+	if isAssigned(expr, path[1]) {
+		return nil, nil, false
+	}
+	return expr, path, true
+}
+
+// isAssigned reports whether expr is assigned by its parent, or has its
+// address taken.
+func isAssigned(expr ast.Expr, parent ast.Node) bool {
+	switch parent := parent.(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range parent.Lhs {
+			if lhs == expr {
+				return true
+			}
+		}
+	case *ast.IncDecStmt:
+		return parent.X == expr
+	case *ast.UnaryExpr:
+		return parent.Op == token.AND
+	}
+	return false
+}
+
+// variable returns the source with the selected expression extracted
+// into a local variable, declared before the enclosing statement.
+func (rf *refactoring) variable() ([]byte, bool) {
+	expr, path, ok := rf.selectedExpr()
+	if !ok {
+		return nil, false
+	}
+
+	// Find the statement of a block enclosing expr, which must be
+	// evaluated once and in order before it.
+	var stmt ast.Stmt
+	for i := 1; i < len(path)-1 && stmt == nil; i++ {
+		switch n := path[i].(type) {
+		case *ast.FuncLit:
+			return nil, false
+		case *ast.BinaryExpr:
+			// The right operand may not be evaluated
+			if (n.Op == token.LAND || n.Op == token.LOR) && contains(n.Y, expr) {
+				return nil, false
+			}
+		case *ast.CaseClause, *ast.CommClause:
+			// Case expressions are evaluated in turn, until one matches
+			return nil, false
+		case *ast.ForStmt:
+			if n.Init == nil || !contains(n.Init, expr) {
+				return nil, false
+			}
+		case *ast.IfStmt:
+			if n.Else != nil && contains(n.Else, expr) {
+				return nil, false
+			}
+			// The init statement is evaluated first
+			if n.Init != nil && !contains(n.Init, expr) {
+				return nil, false
+			}
+		case *ast.SwitchStmt:
+			if n.Init != nil && !contains(n.Init, expr) {
+				return nil, false
+			}
+		case *ast.TypeSwitchStmt:
+			if n.Init != nil && !contains(n.Init, expr) {
+				return nil, false
+			}
+		}
+		if s, ok := path[i].(ast.Stmt); ok && !isClause(s) {
+			if _, ok := stmtList(path[i+1]); ok {
+				stmt = s
+			}
+		}
+	}
+	if stmt == nil {
+		return nil, false
+	}
+
+	// Every variable used must be declared before the statement
+	declared := true
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if v, ok := rf.tcr.info.Uses[id].(*types.Var); ok && !v.IsField() && v.Pos() >= stmt.Pos() {
+				declared = false
+			}
+		}
+		return declared
+	})
+	if !declared {
+		return nil, false
+	}
+
+	name := rf.freeName("newVar", expr.Pos())
+	line := rf.tf.LineStart(rf.tf.Line(stmt.Pos()))
+	indent := rf.text(line, stmt.Pos())
+	return rf.splice(
+		replacement{stmt.Pos(), stmt.Pos(), name + " := " + rf.text(expr.Pos(), expr.End()) + "\n" + indent},
+		replacement{expr.Pos(), expr.End(), name},
+	), true
+}
+
+// constant returns the source with the selected constant expression
+// extracted into a package-level constant, declared before the
+// enclosing declaration.
+func (rf *refactoring) constant() ([]byte, bool) {
+	expr, path, ok := rf.selectedExpr()
+	if !ok || rf.tcr.info.Types[expr].Value == nil {
+		return nil, false
+	}
+
+	// Local constants can't be used at the package level
+	local := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			obj := rf.tcr.info.Uses[id]
+			if _, ok := obj.(*types.PkgName); !ok && obj != nil && obj.Pkg() == rf.tcr.pkg && obj.Parent() != rf.tcr.pkg.Scope() {
+				local = true
+			}
+		}
+		return !local
+	})
+	if local {
+		return nil, false
+	}
+
+	// path ends with the file, preceded by the top-level declaration
+	decl := path[len(path)-2]
+	pos := decl.Pos()
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Doc != nil {
+			pos = decl.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if decl.Doc != nil {
+			pos = decl.Doc.Pos()
+		}
+	}
+
+	name := rf.freeName("newConst", expr.Pos())
+	return rf.splice(
+		replacement{pos, pos, "const " + name + " = " + rf.text(expr.Pos(), expr.End()) + "\n\n"},
+		replacement{expr.Pos(), expr.End(), name},
+	), true
+}
+
+func contains(n ast.Node, expr ast.Expr) bool {
+	return n.Pos() <= expr.Pos() && expr.End() <= n.End()
+}
+
+func isClause(s ast.Stmt) bool {
+	switch s.(type) {
+	case *ast.CaseClause, *ast.CommClause:
+		return true
+	}
+	return false
+}
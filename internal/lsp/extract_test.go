@@ -0,0 +1,274 @@
+package lsp
+
+import (
+	"go/format"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRefactoring returns the refactoring of the selection between the
+// `/*start*/` and `/*end*/` markers of the file src of a package.
+func testRefactoring(t *testing.T, src string) *refactoring {
+	t.Helper()
+	s, locs := testServer(t, map[string]string{"gno.land/r/demo/foo/foo.gno": src})
+	start, end := locs["start"], locs["end"]
+	file, ok := s.snapshot.Get(start.URI.Filename())
+	if !ok {
+		t.Fatal("file not opened")
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		t.Fatal("cannot type-check")
+	}
+	f, tf := tcr.file(filepath.Base(start.URI.Filename()))
+	rf := &refactoring{tcr: tcr, f: f, tf: tf, src: file.Src}
+	rf.start, rf.end = posFromPosition(tf, start.Range.Start), posFromPosition(tf, end.Range.Start)
+	return rf
+}
+
+// formatted returns src formatted, failing if it is invalid.
+func formatted(t *testing.T, src []byte) string {
+	t.Helper()
+	b, err := format.Source(src)
+	if err != nil {
+		t.Fatalf("invalid result: %v\n%s", err, src)
+	}
+	return string(b)
+}
+
+func TestExtractFunction(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // lines of the result
+	}{
+		{
+			name: "field write",
+			src: `package foo
+
+type T struct{ n int }
+
+func F() int {
+	var x T
+	/*start*/x.n = 5/*end*/
+	return x.n
+}
+`,
+			want: []string{"x = newFunction(x)", "func newFunction(x T) T {", "return x"},
+		},
+		{
+			name: "array element write",
+			src: `package foo
+
+func F() int {
+	var a [2]int
+	/*start*/a[0] = 5/*end*/
+	return a[0]
+}
+`,
+			want: []string{"a = newFunction(a)", "func newFunction(a [2]int) [2]int {"},
+		},
+		{
+			name: "field increment",
+			src: `package foo
+
+type T struct{ n int }
+
+func F() int {
+	var x T
+	/*start*/x.n++/*end*/
+	return x.n
+}
+`,
+			want: []string{"x = newFunction(x)"},
+		},
+		{
+			name: "field address",
+			src: `package foo
+
+type T struct{ n int }
+
+func set(p *int) { *p = 1 }
+
+func F() int {
+	var x T
+	/*start*/set(&x.n)/*end*/
+	return x.n
+}
+`,
+			want: []string{"x = newFunction(x)"},
+		},
+		{
+			name: "pointer receiver method",
+			src: `package foo
+
+type C struct{ n int }
+
+func (c *C) Inc() { c.n++ }
+
+func F() int {
+	var c C
+	/*start*/c.Inc()/*end*/
+	return c.n
+}
+`,
+			want: []string{"c = newFunction(c)"},
+		},
+		{
+			name: "write through pointer",
+			src: `package foo
+
+type T struct{ n int }
+
+func F(x *T) int {
+	/*start*/x.n = 5/*end*/
+	return x.n
+}
+`,
+			want: []string{"newFunction(x)", "func newFunction(x *T) {"},
+		},
+		{
+			name: "slice element write",
+			src: `package foo
+
+func F(s []int) int {
+	/*start*/s[0] = 5/*end*/
+	return s[0]
+}
+`,
+			want: []string{"newFunction(s)", "func newFunction(s []int) {"},
+		},
+		{
+			name: "write read in the next iteration",
+			src: `package foo
+
+func F(xs []int) {
+	sum := 0
+	for _, v := range xs {
+		println(sum)
+		/*start*/sum += v/*end*/
+	}
+}
+`,
+			want: []string{"sum = newFunction(sum, v)", "func newFunction(sum int, v int) int {"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, ok := testRefactoring(t, tt.src).function()
+			if !ok {
+				t.Fatal("extraction refused")
+			}
+			got := formatted(t, src)
+			for _, line := range tt.want {
+				if !strings.Contains(got, line) {
+					t.Errorf("missing %q in:\n%s", line, got)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractVariable(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		ok   bool
+	}{
+		{
+			name: "operand",
+			src: `package foo
+
+func F(a, b int) int {
+	return /*start*/a * 2/*end*/ + b
+}
+`,
+			ok: true,
+		},
+		{
+			name: "left operand of &&",
+			src: `package foo
+
+func F(s []int) bool {
+	return /*start*/len(s) > 0/*end*/ && s[0] == 1
+}
+`,
+			ok: true,
+		},
+		{
+			name: "right operand of &&",
+			src: `package foo
+
+func F(s []int) bool {
+	return len(s) > 0 && /*start*/s[0] == 1/*end*/
+}
+`,
+		},
+		{
+			name: "right operand of ||",
+			src: `package foo
+
+func F(p *int) bool {
+	return p == nil || /*start*/*p == 0/*end*/
+}
+`,
+		},
+		{
+			name: "case expression",
+			src: `package foo
+
+func g() int { return 1 }
+
+func F(x int) int {
+	switch x {
+	case 0:
+		return 0
+	case /*start*/g() + 1/*end*/:
+		return 1
+	}
+	return 2
+}
+`,
+		},
+		{
+			name: "case body",
+			src: `package foo
+
+func F(x int) int {
+	switch x {
+	case 0:
+		return /*start*/x + 1/*end*/
+	}
+	return 2
+}
+`,
+			ok: true,
+		},
+		{
+			name: "if condition after init",
+			src: `package foo
+
+func g() int { return 1 }
+
+func F(x int) bool {
+	if y := g(); /*start*/x + 1/*end*/ > y {
+		return true
+	}
+	return false
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, ok := testRefactoring(t, tt.src).variable()
+			if ok != tt.ok {
+				t.Fatalf("extracted = %v, want %v\n%s", ok, tt.ok, src)
+			}
+			if ok {
+				formatted(t, src)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+
+	"github.com/harry-hov/gnopls/internal/tools"
+)
+
+// filetestDirectives contains the comment directives understood by
+// `gno test` in filetests, with their documentation.
+//
+// Directives are comment groups starting with `// <Name>:`, followed by
+// a value (e.g. `PKGPATH`) or by the expected content (e.g. `Output`).
+var filetestDirectives = map[string]string{
+	"PKGPATH":  "`PKGPATH` sets the package path the filetest is run as. Use a `gno.land/r/...` path to run it as a realm.\n\n```gno\n// PKGPATH: gno.land/r/demo/foo_test\n```",
+	"MAXALLOC": "`MAXALLOC` sets the maximum number of bytes the filetest is allowed to allocate.\n\n```gno\n// MAXALLOC: 100000000\n```",
+	"SEND":     "`SEND` sets the coins sent along with the filetest call.\n\n```gno\n// SEND: 200000000ugnot\n```",
+	"Output":   "`Output` contains the expected output of the filetest, compared with what `main` prints.",
+	"Error":    "`Error` contains the expected error (e.g. panic message) of the filetest.",
+	"Realm":    "`Realm` contains the expected realm operations (state changes) made by the filetest.",
+}
+
+// filetestDirective is a directive found in a filetest.
+type filetestDirective struct {
+	Name  string
+	Value string
+	// Comment is the first line of the directive comment group,
+	// Content contains the following ones.
+	Comment *ast.Comment
+	Content []*ast.Comment
+}
+
+var directiveRe = regexp.MustCompile(`^//\s?([A-Za-z]+):(.*)$`)
+
+// parseDirectives returns the comment groups of f looking like
+// filetest directives, including the unknown ones.
+func parseDirectives(f *ast.File) []*filetestDirective {
+	res := []*filetestDirective{}
+	for _, cg := range f.Comments {
+		m := directiveRe.FindStringSubmatch(cg.List[0].Text)
+		if m == nil {
+			continue
+		}
+		name, value := m[1], strings.TrimSpace(m[2])
+		if _, ok := filetestDirectives[name]; !ok && !looksLikeDirective(name) {
+			continue
+		}
+		d := &filetestDirective{
+			Name:    name,
+			Value:   value,
+			Comment: cg.List[0],
+		}
+		for _, c := range cg.List[1:] {
+			if !strings.HasPrefix(c.Text, "//") {
+				break
+			}
+			d.Content = append(d.Content, c)
+		}
+		res = append(res, d)
+	}
+	return res
+}
+
+// looksLikeDirective reports whether an unknown `// <name>: <value>`
+// comment is likely a misspelled directive rather than a regular comment,
+// i.e. name is close to the name of a directive.
+func looksLikeDirective(name string) bool {
+	_, ok := closestDirective(name)
+	return ok
+}
+
+// closestDirective returns the directive whose name is at most one or
+// two edits away from name, ignoring case, e.g. `Outptu` or `PKGPAHT`.
+func closestDirective(name string) (string, bool) {
+	for known := range filetestDirectives {
+		if editDistance(strings.ToLower(name), strings.ToLower(known)) <= 1+len(known)/8 {
+			return known, true
+		}
+	}
+	return "", false
+}
+
+// editDistance returns the number of insertions, deletions,
+// substitutions and transpositions of adjacent bytes turning a into b.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+// filetestPkgPath returns the `PKGPATH` of the filetest src, or
+// `main` if not set.
+func filetestPkgPath(src string) string {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments|parser.PackageClauseOnly)
+	if err != nil {
+		return "main"
+	}
+	for _, d := range parseDirectives(f) {
+		if d.Name == "PKGPATH" && d.Value != "" {
+			return d.Value
+		}
+	}
+	return "main"
+}
+
+// directiveErrors validates the directives of the filetest pgf.
+func directiveErrors(pgf *ParsedGnoFile) []ErrorInfo {
+	res := []ErrorInfo{}
+	for _, d := range parseDirectives(pgf.File) {
+		pos := pgf.Fset.Position(d.Comment.Pos())
+		var msg string
+		switch _, ok := filetestDirectives[d.Name]; {
+		case !ok:
+			msg = fmt.Sprintf("unknown filetest directive %q", d.Name)
+			if known, ok := closestDirective(d.Name); ok {
+				msg += fmt.Sprintf(", did you mean %q?", known)
+			}
+		case d.Name == "PKGPATH" && d.Value == "":
+			msg = "missing package path"
+		case d.Name == "MAXALLOC":
+			if _, err := strconv.Atoi(d.Value); err != nil {
+				msg = fmt.Sprintf("invalid maxalloc amount: %q", d.Value)
+			}
+		}
+		if msg == "" {
+			continue
+		}
+		res = append(res, ErrorInfo{
+			FileName: pos.Filename,
+			Line:     pos.Line,
+			Column:   pos.Column,
+			Span:     []int{pos.Column, pos.Column + len(d.Comment.Text)},
+			Msg:      msg,
+			Tool:     "filetest",
+		})
+	}
+	return res
+}
+
+// hoverDirective returns the documentation of the directive at line
+// (0-based), if any.
+func hoverDirective(ctx context.Context, reply jsonrpc2.Replier, pgf *ParsedGnoFile, line int) (bool, error) {
+	for _, d := range parseDirectives(pgf.File) {
+		pos := pgf.Fset.Position(d.Comment.Pos())
+		if pos.Line-1 != line {
+			continue
+		}
+		doc, ok := filetestDirectives[d.Name]
+		if !ok {
+			return false, nil
+		}
+		return true, reply(ctx, protocol.Hover{
+			Contents: protocol.MarkupContent{
+				Kind:  protocol.Markdown,
+				Value: doc,
+			},
+			Range: &protocol.Range{
+				Start: protocol.Position{Line: uint32(line), Character: uint32(pos.Column - 1)},
+				End:   protocol.Position{Line: uint32(line), Character: uint32(pos.Column - 1 + len(d.Comment.Text))},
+			},
+		}, nil)
+	}
+	return false, nil
+}
+
+// updateOutputArgs are the arguments of `gnopls.updateFiletestOutput`.
+type updateOutputArgs struct {
+	URI protocol.DocumentURI `json:"uri"`
+}
+
+// cmdUpdateFiletestOutput runs the filetest in background and replaces
+// its expected results (`// Output:`, `// Error:` and `// Realm:`) with
+// the actual ones.
+func cmdUpdateFiletestOutput(ctx context.Context, s *server, args updateOutputArgs) (any, error) {
+	if !isFiletest(args.URI.Filename()) {
+		return nil, fmt.Errorf("%s is not a filetest", args.URI.Filename())
+	}
+	go s.updateFiletestOutput(context.WithoutCancel(ctx), args.URI)
+	return nil, nil
+}
+
+// updateFiletestOutput runs `gno test -update-golden-tests` on the
+// filetest, in a copy of its package directory with the unsaved content
+// of its files, and applies the result.
+func (s *server) updateFiletestOutput(ctx context.Context, uri protocol.DocumentURI) {
+	filename := uri.Filename()
+	src, err := s.snapshot.ReadFile(filename)
+	if err != nil {
+		s.showMessage(ctx, protocol.MessageTypeError, err.Error())
+		return
+	}
+	dir, err := os.MkdirTemp("", "gnopls-filetest-")
+	if err != nil {
+		s.showMessage(ctx, protocol.MessageTypeError, err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	if err := s.copyPackage(filepath.Dir(filename), dir); err != nil {
+		s.showMessage(ctx, protocol.MessageTypeError, err.Error())
+		return
+	}
+	tmpFile := filepath.Join(dir, filepath.Base(filename))
+
+	run := "^file$/^" + regexp.QuoteMeta(filepath.Base(filename)) + "$"
+	out, err := tools.UpdateGoldenTests(ctx, dir, run)
+	slog.Info("update golden tests", "file", filename, "output", string(out))
+	if err != nil {
+		s.showMessage(ctx, protocol.MessageTypeError, "gno test: "+lastLines(string(out), 5))
+		return
+	}
+	updated, err := os.ReadFile(tmpFile)
+	if err != nil {
+		s.showMessage(ctx, protocol.MessageTypeError, err.Error())
+		return
+	}
+	if bytes.Equal(updated, src) {
+		return
+	}
+
+	err = s.applyEdit(ctx, "Update filetest output", protocol.WorkspaceEdit{
+		Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+			uri: {replaceAll(updated)},
+		},
+	})
+	if err != nil {
+		s.showMessage(ctx, protocol.MessageTypeError, err.Error())
+	}
+}
+
+// copyPackage copies the package directory dir to dst, with the
+// unsaved content of its files.
+func (s *server) copyPackage(dir, dst string) error {
+	if err := copyDir(dir, dst); err != nil {
+		return err
+	}
+	files, err := ListGnoFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, fname := range files {
+		file, ok := s.snapshot.Get(fname)
+		if !ok {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dst, filepath.Base(fname)), file.Src, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// goldenDirectives are the directives `gno test -update-golden-tests`
+// rewrites.
+var goldenDirectives = map[string]bool{"Output": true, "Error": true, "Realm": true}
+
+// codeActionsFiletest returns the code actions available in filetests:
+// updating the expected results, offered on their directives, or
+// anywhere if there is none yet.
+func codeActionsFiletest(file *GnoFile, params protocol.CodeActionParams) []protocol.CodeAction {
+	if !kindRequested(params.Context.Only, protocol.Source) {
+		return nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file.URI.Filename(), file.Src, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	found, onDirective := false, false
+	for _, d := range parseDirectives(f) {
+		if !goldenDirectives[d.Name] {
+			continue
+		}
+		found = true
+		last := ast.Node(d.Comment)
+		if len(d.Content) > 0 {
+			last = d.Content[len(d.Content)-1]
+		}
+		start, end := fset.Position(d.Comment.Pos()).Line-1, fset.Position(last.End()).Line-1
+		if int(params.Range.Start.Line) <= end && int(params.Range.End.Line) >= start {
+			onDirective = true
+		}
+	}
+	if found && !onDirective {
+		return nil
+	}
+
+	title := "Update filetest output with actual results"
+	return []protocol.CodeAction{commandAction(title, "gnopls.updateFiletestOutput", updateOutputArgs{URI: params.TextDocument.URI})}
+}
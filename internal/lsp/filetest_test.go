@@ -0,0 +1,39 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyPackage(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/r/demo/foo/gno.mod":          "module gno.land/r/demo/foo\n",
+		"gno.land/r/demo/foo/foo.gno":          "package foo\n\nvar X = 1\n",
+		"gno.land/r/demo/foo/z_filetest.gno":   "package main\n\n/*use*/func main() {}\n",
+		"gno.land/r/demo/foo/testdata/out.txt": "out\n",
+	})
+	filename := locs["use"].URI.Filename()
+	file, _ := s.snapshot.Get(filename)
+	file.Src = []byte("package main\n\nfunc main() { println(1) }\n")
+
+	dst := t.TempDir()
+	if err := s.copyPackage(filepath.Dir(filename), dst); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"gno.mod":          "module gno.land/r/demo/foo\n",
+		"foo.gno":          "package foo\n\nvar X = 1\n",
+		"z_filetest.gno":   string(file.Src),
+		"testdata/out.txt": "out\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
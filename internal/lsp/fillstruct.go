@@ -0,0 +1,79 @@
+package lsp
+
+import (
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// codeActionsFillStruct returns the "Fill" code action of the empty
+// struct literal at the start of rng in file, which lists every field
+// with its zero value.
+func (s *server) codeActionsFillStruct(file *GnoFile, rng protocol.Range) []protocol.CodeAction {
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil
+	}
+	f, tf := tcr.file(filepath.Base(file.URI.Filename()))
+	if f == nil {
+		return nil
+	}
+	pos := posFromPosition(tf, rng.Start)
+	if !pos.IsValid() {
+		return nil
+	}
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	var lit *ast.CompositeLit
+	for _, n := range path {
+		if n, ok := n.(*ast.CompositeLit); ok {
+			lit = n
+			break
+		}
+	}
+	if lit == nil || len(lit.Elts) > 0 {
+		return nil
+	}
+	t := tcr.info.TypeOf(lit)
+	if t == nil {
+		return nil
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok || st.NumFields() == 0 {
+		return nil
+	}
+
+	fi := newFileImports(tcr.pkg, f)
+	var b strings.Builder
+	b.WriteString("{\n")
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Exported() && field.Pkg() != tcr.pkg {
+			continue
+		}
+		b.WriteString(field.Name() + ": " + zeroValue(field.Type(), fi.qualifier) + ",\n")
+	}
+	b.WriteString("}")
+
+	rf := &refactoring{tcr: tcr, f: f, tf: tf, src: file.Src}
+	src, err := fi.addImports(rf.splice(replacement{lit.Lbrace, lit.Rbrace + 1, b.String()}))
+	if err != nil {
+		return nil
+	}
+	edit, err := s.formattedEdit(file.URI, src)
+	if err != nil {
+		return nil
+	}
+	title := "Fill struct"
+	if lit.Type != nil {
+		title = "Fill " + rf.text(lit.Type.Pos(), lit.Type.End())
+	}
+	return []protocol.CodeAction{{
+		Title: title,
+		Kind:  protocol.RefactorRewrite,
+		Edit:  edit,
+	}}
+}
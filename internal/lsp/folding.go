@@ -0,0 +1,115 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/token"
+	"sort"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func (s *server) FoldingRange(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.FoldingRangeParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	file, ok := s.snapshot.Get(params.TextDocument.URI.Filename())
+	if !ok {
+		return reply(ctx, nil, errors.New("snapshot not found"))
+	}
+	pgf, err := file.ParseGno2(ctx)
+	if err != nil {
+		return reply(ctx, nil, nil)
+	}
+	return reply(ctx, foldingRanges(pgf, s.lineFoldingOnly()), nil)
+}
+
+// lineFoldingOnly reports whether the client folds complete lines only.
+func (s *server) lineFoldingOnly() bool {
+	td := s.capabilities.TextDocument
+	return td != nil && td.FoldingRange != nil && td.FoldingRange.LineFoldingOnly
+}
+
+// foldingRanges returns the folding ranges of pgf: import blocks,
+// function bodies, composite literals, comment blocks, multi-line
+// strings and filetest directives.
+//
+// If lineOnly is set, the line of the closing delimiter of blocks is
+// kept visible.
+func foldingRanges(pgf *ParsedGnoFile, lineOnly bool) []protocol.FoldingRange {
+	ranges := []protocol.FoldingRange{}
+	add := func(start, end token.Pos, kind protocol.FoldingRangeKind, delimited bool) {
+		if !start.IsValid() || !end.IsValid() {
+			return
+		}
+		s, e := positionOf(pgf.Fset, start), positionOf(pgf.Fset, end)
+		r := protocol.FoldingRange{
+			StartLine:      s.Line,
+			StartCharacter: s.Character,
+			EndLine:        e.Line,
+			EndCharacter:   e.Character,
+			Kind:           kind,
+		}
+		if delimited {
+			// Fold between the delimiters
+			r.StartCharacter++
+			if lineOnly {
+				r.EndLine--
+			}
+		}
+		if r.EndLine <= r.StartLine {
+			return
+		}
+		ranges = append(ranges, r)
+	}
+
+	ast.Inspect(pgf.File, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GenDecl:
+			if n.Tok == token.IMPORT && n.Lparen.IsValid() {
+				add(n.Lparen, n.Rparen, protocol.ImportsFoldingRange, true)
+			}
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				add(n.Body.Lbrace, n.Body.Rbrace, "", true)
+			}
+		case *ast.FuncLit:
+			add(n.Body.Lbrace, n.Body.Rbrace, "", true)
+		case *ast.CompositeLit:
+			add(n.Lbrace, n.Rbrace, "", true)
+		case *ast.BasicLit:
+			if n.Kind == token.STRING {
+				add(n.Pos(), n.End(), "", false)
+			}
+		}
+		return true
+	})
+
+	directives := map[*ast.Comment]bool{}
+	if isFiletest(pgf.URI.Filename()) {
+		for _, d := range parseDirectives(pgf.File) {
+			directives[d.Comment] = true
+			if len(d.Content) > 0 {
+				add(d.Comment.Pos(), d.Content[len(d.Content)-1].End(), protocol.RegionFoldingRange, false)
+			}
+		}
+	}
+	for _, cg := range pgf.File.Comments {
+		if !directives[cg.List[0]] {
+			add(cg.Pos(), cg.End(), protocol.CommentFoldingRange, false)
+		}
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].StartLine != ranges[j].StartLine {
+			return ranges[i].StartLine < ranges[j].StartLine
+		}
+		return ranges[i].EndLine > ranges[j].EndLine
+	})
+	return ranges
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
-	"math"
 
 	"github.com/harry-hov/gnopls/internal/tools"
 
@@ -31,16 +30,5 @@ func (s *server) Formatting(ctx context.Context, reply jsonrpc2.Replier, req jso
 	}
 
 	slog.Info("format " + string(params.TextDocument.URI.Filename()))
-	return reply(ctx, []protocol.TextEdit{
-		{
-			Range: protocol.Range{
-				Start: protocol.Position{Line: 0, Character: 0},
-				End: protocol.Position{
-					Line:      math.MaxInt32,
-					Character: math.MaxInt32,
-				},
-			},
-			NewText: string(formatted),
-		},
-	}, nil)
+	return reply(ctx, []protocol.TextEdit{replaceAll(formatted)}, nil)
 }
@@ -36,6 +36,9 @@ func (s *server) DidClose(ctx context.Context, reply jsonrpc2.Replier, req jsonr
 		return sendParseError(ctx, reply, err)
 	}
 
+	// Delta requests aren't sent for closed documents
+	s.semanticTokensResults.Remove(params.TextDocument.URI.Filename())
+
 	slog.Info("close" + string(params.TextDocument.URI.Filename()))
 	return reply(ctx, s.conn.Notify(ctx, protocol.MethodTextDocumentDidClose, nil), nil)
 }
@@ -0,0 +1,342 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/harry-hov/gnopls/internal/tools"
+
+	"go.lsp.dev/protocol"
+)
+
+// generateTestArgs are the arguments of `gnopls.generateTest` and
+// `gnopls.generateFiletest`.
+type generateTestArgs struct {
+	URI  protocol.DocumentURI `json:"uri"`
+	Func string               `json:"func"`
+}
+
+// codeActionsGenerateTest returns the code actions generating a unit test
+// and a filetest for the exported function declared at the start of rng.
+func (s *server) codeActionsGenerateTest(file *GnoFile, rng protocol.Range) []protocol.CodeAction {
+	filename := file.URI.Filename()
+	if isTestFile(filename) || isFiletest(filename) {
+		return nil
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil
+	}
+	f, tf := tcr.file(filepath.Base(filename))
+	if f == nil {
+		return nil
+	}
+	pos := posFromPosition(tf, rng.Start)
+	if !pos.IsValid() {
+		return nil
+	}
+	id, obj := tcr.identAt(f, pos)
+	fn, ok := obj.(*types.Func)
+	if !ok || tcr.info.Defs[id] != fn || !testable(fn) {
+		return nil
+	}
+
+	args := generateTestArgs{URI: file.URI, Func: fn.Name()}
+	actions := []protocol.CodeAction{}
+	if _, exists := s.testFileFunc(filename, testName(fn)); !exists {
+		actions = append(actions, commandAction("Generate unit test for "+fn.Name(), "gnopls.generateTest", args))
+	}
+	actions = append(actions, commandAction("Generate filetest for "+fn.Name(), "gnopls.generateFiletest", args))
+	return actions
+}
+
+// commandAction returns a `source` code action running command.
+func commandAction(title, command string, args interface{}) protocol.CodeAction {
+	return protocol.CodeAction{
+		Title: title,
+		Kind:  protocol.Source,
+		Command: &protocol.Command{
+			Title:     title,
+			Command:   command,
+			Arguments: []interface{}{args},
+		},
+	}
+}
+
+// testable reports whether tests can be generated for fn: an exported,
+// non-generic function.
+func testable(fn *types.Func) bool {
+	sig := fn.Type().(*types.Signature)
+	return fn.Exported() && sig.Recv() == nil && sig.TypeParams() == nil
+}
+
+// testName returns the name of the unit test of fn.
+func testName(fn *types.Func) string {
+	return "Test" + fn.Name()
+}
+
+// testFile returns the name of the unit test file of filename.
+func testFile(filename string) string {
+	return strings.TrimSuffix(filename, ".gno") + "_test.gno"
+}
+
+// testFileFunc returns the content of the unit test file of filename,
+// and whether it declares the function name.
+func (s *server) testFileFunc(filename, name string) ([]byte, bool) {
+	src, err := s.snapshot.ReadFile(testFile(filename))
+	if err != nil {
+		return nil, false
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return src, false
+	}
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Name.Name == name {
+			return src, true
+		}
+	}
+	return src, false
+}
+
+// cmdGenerateTest appends a table-driven test of a function to the unit
+// test file of its file, creating it if needed.
+func cmdGenerateTest(ctx context.Context, s *server, args generateTestArgs) (any, error) {
+	tcr, fn, err := s.testedFunc(args)
+	if err != nil {
+		return nil, err
+	}
+	filename := testFile(args.URI.Filename())
+	src, exists := s.testFileFunc(args.URI.Filename(), testName(fn))
+	if exists {
+		return nil, fmt.Errorf("%s already exists", testName(fn))
+	}
+	if src == nil {
+		src = []byte("package " + tcr.pkg.Name() + "\n")
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s", filepath.Base(filename))
+	}
+
+	// Functions are qualified in an external test package
+	pkg := tcr.pkg
+	if f.Name.Name != pkg.Name() {
+		pkg = types.NewPackage(pkg.Path()+"_test", f.Name.Name)
+	}
+	fi := newFileImports(pkg, f)
+	test := unitTest(fn, fi.qualifier(types.NewPackage("testing", "testing")), fi.qualifier)
+	src = append(append(src, '\n'), test...)
+	return nil, s.writeGenerated(ctx, "Generate unit test", filename, src, fi)
+}
+
+// cmdGenerateFiletest creates a filetest calling a function and printing
+// its results, with an empty `// Output:` block.
+func cmdGenerateFiletest(ctx context.Context, s *server, args generateTestArgs) (any, error) {
+	_, fn, err := s.testedFunc(args)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(args.URI.Filename())
+	base := "z_" + strings.ToLower(fn.Name())
+	filename := filepath.Join(dir, base+"_filetest.gno")
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		filename = filepath.Join(dir, fmt.Sprintf("%s_%d_filetest.gno", base, i))
+	}
+
+	src := []byte("package main\n")
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	fi := newFileImports(types.NewPackage("main", "main"), f)
+	src = append(src, filetestMain(fn, fi.qualifier)...)
+	return nil, s.writeGenerated(ctx, "Generate filetest", filename, src, fi)
+}
+
+// testedFunc returns the function of args.
+func (s *server) testedFunc(args generateTestArgs) (*TypeCheckResult, *types.Func, error) {
+	file, ok := s.snapshot.Get(args.URI.Filename())
+	if !ok {
+		return nil, nil, errors.New("snapshot not found")
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil, nil, errors.New("cannot type-check the package")
+	}
+	fn, ok := tcr.pkg.Scope().Lookup(args.Func).(*types.Func)
+	if !ok || !testable(fn) {
+		return nil, nil, fmt.Errorf("no exported function %s", args.Func)
+	}
+	return tcr, fn, nil
+}
+
+// writeGenerated adds the imports of fi to the generated src, formats it,
+// and asks the client to write it to filename.
+func (s *server) writeGenerated(ctx context.Context, label, filename string, src []byte, fi *fileImports) error {
+	src, err := fi.addImports(src)
+	if err != nil {
+		return err
+	}
+	formatted, err := tools.Format(string(src), s.formatOpt)
+	if err != nil {
+		return err
+	}
+
+	uri := getURI(filename)
+	edit := workspaceEdit{}
+	if _, err := s.snapshot.ReadFile(filename); err != nil {
+		edit.DocumentChanges = append(edit.DocumentChanges, protocol.CreateFile{
+			Kind: protocol.CreateResourceOperation,
+			URI:  uri,
+		})
+	}
+	edit.DocumentChanges = append(edit.DocumentChanges, protocol.TextDocumentEdit{
+		TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+		},
+		Edits: []protocol.TextEdit{replaceAll(formatted)},
+	})
+	go func() {
+		if err := s.applyDocumentChanges(context.WithoutCancel(ctx), label, edit); err != nil {
+			s.showMessage(ctx, protocol.MessageTypeError, err.Error())
+		}
+	}()
+	return nil
+}
+
+// unitTest returns a table-driven test of fn: a test case has a name,
+// the arguments and the expected results of fn. An error result is
+// expected with a `wantErr` boolean.
+func unitTest(fn *types.Func, testing string, qf types.Qualifier) string {
+	sig := fn.Type().(*types.Signature)
+	var b strings.Builder
+	fmt.Fprintf(&b, "func %s(t *%s.T) {\n", testName(fn), testing)
+	b.WriteString("tests := []struct {\nname string\n")
+
+	// The names of the test, reserved for the fields of the parameters
+	taken := map[string]bool{"name": true, "t": true, "tests": true, "tt": true, "err": true, "wantErr": true}
+	for i := 0; i < sig.Results().Len(); i++ {
+		suffix := ""
+		if i > 0 {
+			suffix = fmt.Sprint(i)
+		}
+		taken["want"+suffix], taken["got"+suffix] = true, true
+	}
+	params := make([]string, sig.Params().Len())
+	for i := range params {
+		if name := sig.Params().At(i).Name(); name != "" && name != "_" && !taken[name] {
+			params[i] = name
+			taken[name] = true
+		}
+	}
+	for i := range params {
+		for n := i; params[i] == ""; n++ {
+			if name := fmt.Sprintf("arg%d", n); !taken[name] {
+				params[i] = name
+				taken[name] = true
+			}
+		}
+		fmt.Fprintf(&b, "%s %s\n", params[i], types.TypeString(sig.Params().At(i).Type(), qf))
+	}
+
+	var got, want []string
+	wantErr := false
+	for i := 0; i < sig.Results().Len(); i++ {
+		t := sig.Results().At(i).Type()
+		if i == sig.Results().Len()-1 && types.Identical(t, errorType) {
+			wantErr = true
+			b.WriteString("wantErr bool\n")
+			got = append(got, "err")
+			continue
+		}
+		name := "want"
+		if i > 0 {
+			name = fmt.Sprintf("want%d", i)
+		}
+		fmt.Fprintf(&b, "%s %s\n", name, types.TypeString(t, qf))
+		got = append(got, "got"+strings.TrimPrefix(name, "want"))
+		want = append(want, name)
+	}
+	b.WriteString("}{\n// TODO: add test cases.\n}\n")
+
+	args := make([]string, len(params))
+	for i, p := range params {
+		args[i] = "tt." + p
+	}
+	call := fn.Name()
+	if q := qf(fn.Pkg()); q != "" {
+		call = q + "." + call
+	}
+	call += "(" + strings.Join(args, ", ")
+	if sig.Variadic() {
+		call += "..."
+	}
+	call += ")"
+
+	b.WriteString("for _, tt := range tests {\n")
+	fmt.Fprintf(&b, "t.Run(tt.name, func(t *%s.T) {\n", testing)
+	if len(got) == 0 {
+		b.WriteString(call + "\n")
+	} else {
+		b.WriteString(strings.Join(got, ", ") + " := " + call + "\n")
+	}
+	if wantErr {
+		fmt.Fprintf(&b, "if (err != nil) != tt.wantErr {\nt.Errorf(\"%s() error = %%v, wantErr %%v\", err, tt.wantErr)\nreturn\n}\n", fn.Name())
+	}
+	for i, w := range want {
+		g := got[i]
+		if types.Comparable(sig.Results().At(i).Type()) {
+			fmt.Fprintf(&b, "if %s != tt.%s {\nt.Errorf(\"%s() %s = %%v, want %%v\", %s, tt.%s)\n}\n", g, w, fn.Name(), g, g, w)
+		} else {
+			fmt.Fprintf(&b, "_ = %s // TODO: compare with tt.%s\n", g, w)
+		}
+	}
+	b.WriteString("})\n}\n}\n")
+	return b.String()
+}
+
+// filetestMain returns the main function of a filetest calling fn with
+// zero values, and printing its results.
+func filetestMain(fn *types.Func, qf types.Qualifier) string {
+	sig := fn.Type().(*types.Signature)
+	params := sig.Params().Len()
+	if sig.Variadic() {
+		params--
+	}
+	args := make([]string, params)
+	for i := range args {
+		args[i] = zeroValue(sig.Params().At(i).Type(), qf)
+	}
+	call := qf(fn.Pkg()) + "." + fn.Name() + "(" + strings.Join(args, ", ") + ")"
+
+	var b strings.Builder
+	b.WriteString("\nfunc main() {\n")
+	switch n := sig.Results().Len(); n {
+	case 0:
+		b.WriteString(call + "\n")
+	case 1:
+		b.WriteString("println(" + call + ")\n")
+	default:
+		results := make([]string, n)
+		for i := range results {
+			results[i] = fmt.Sprintf("r%d", i)
+		}
+		list := strings.Join(results, ", ")
+		b.WriteString(list + " := " + call + "\n")
+		b.WriteString("println(" + list + ")\n")
+	}
+	b.WriteString("}\n\n// Output:\n")
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package lsp
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// fakeTesting is the part of the testing package used by unit tests.
+const fakeTesting = `package testing
+
+type T struct{}
+
+func (*T) Run(name string, f func(t *T)) bool { return true }
+func (*T) Errorf(format string, args ...any) {}
+`
+
+// checkFiles type-checks the package path made of srcs, importing the
+// testing package and the packages of imports.
+func checkFiles(t *testing.T, path string, imports map[string]*types.Package, srcs ...string) (*types.Package, error) {
+	t.Helper()
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, src := range srcs {
+		f, err := parser.ParseFile(fset, "", src, 0)
+		if err != nil {
+			t.Fatalf("%v\n%s", err, src)
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: importerFunc(func(path string) (*types.Package, error) {
+		if pkg, ok := imports[path]; ok {
+			return pkg, nil
+		}
+		if path == "testing" {
+			return checkFiles(t, path, nil, fakeTesting)
+		}
+		return importer.Default().Import(path)
+	})}
+	return conf.Check(path, fset, files, nil)
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+func TestUnitTest(t *testing.T) {
+	const src = `package foo
+
+func F(want int, wantErr bool, got, tt, tests, arg1 string, name, _, t int) (int, string, error) {
+	return 0, "", nil
+}
+`
+	pkg, err := checkFiles(t, "gno.land/p/demo/foo", nil, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := pkg.Scope().Lookup("F").(*types.Func)
+
+	t.Run("internal", func(t *testing.T) {
+		test := unitTest(fn, "testing", func(*types.Package) string { return "" })
+		if _, err := checkFiles(t, pkg.Path(), nil, src, "package foo\n\nimport \"testing\"\n\n"+test); err != nil {
+			t.Errorf("%v\n%s", err, test)
+		}
+	})
+	t.Run("external", func(t *testing.T) {
+		f, err := parser.ParseFile(token.NewFileSet(), "", "package foo_test\n", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi := newFileImports(types.NewPackage(pkg.Path()+"_test", "foo_test"), f)
+		test := unitTest(fn, "testing", fi.qualifier)
+		if !strings.Contains(test, "foo.F(") {
+			t.Errorf("unqualified call:\n%s", test)
+		}
+		header := "package foo_test\n\nimport (\n\"testing\"\n\"gno.land/p/demo/foo\"\n)\n\n"
+		imports := map[string]*types.Package{pkg.Path(): pkg}
+		if _, err := checkFiles(t, pkg.Path()+"_test", imports, header+test); err != nil {
+			t.Errorf("%v\n%s", err, test)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/harry-hov/gnopls/internal/tools"
+)
+
+// runTestsArgs are the arguments of `gnopls.runTests`.
+type runTestsArgs struct {
+	// URI of a file in the package to test.
+	URI protocol.DocumentURI `json:"uri"`
+	// Tests to run, all tests of the package are run if empty.
+	Tests []string `json:"tests,omitempty"`
+}
+
+// cmdRunTests runs `gno test` in background, reporting its progress
+// and publishing failures as diagnostics of the test files.
+func cmdRunTests(ctx context.Context, s *server, args runTestsArgs) (any, error) {
+	if args.URI == "" {
+		return nil, fmt.Errorf("missing uri")
+	}
+	dir := filepath.Dir(args.URI.Filename())
+	token := workDoneToken(ctx)
+	go s.runTests(context.WithoutCancel(ctx), dir, args.Tests, token)
+	return nil, nil
+}
+
+func (s *server) runTests(ctx context.Context, dir string, tests []string, token *protocol.ProgressToken) {
+	title := "gno test " + filepath.Base(dir)
+	if len(tests) == 1 {
+		title = "gno test " + tests[0]
+	}
+	wd := s.beginProgress(ctx, token, title)
+
+	var out bytes.Buffer
+	w := &lineWriter{fn: func(line string) {
+		out.WriteString(line + "\n")
+		if strings.HasPrefix(line, "=== RUN") {
+			wd.report(ctx, strings.TrimSpace(strings.TrimPrefix(line, "=== RUN")))
+		}
+	}}
+	err := tools.Test(ctx, dir, testsRunFlag(tests), w)
+	w.Flush()
+	slog.Info("test", "dir", dir, "output", out.String())
+
+	failures := parseTestOutput(out.String())
+	if err != nil && len(failures) == 0 {
+		wd.end(ctx, "FAIL")
+		s.showMessage(ctx, protocol.MessageTypeError, "gno test: "+lastLines(out.String(), 5))
+		return
+	}
+
+	s.publishTestDiagnostics(ctx, dir, failures)
+	if len(failures) > 0 {
+		wd.end(ctx, fmt.Sprintf("FAIL: %d failed", len(failures)))
+		return
+	}
+	wd.end(ctx, "PASS")
+}
+
+// testsRunFlag returns the `-run` regexp matching exactly tests.
+func testsRunFlag(tests []string) string {
+	if len(tests) == 0 {
+		return ""
+	}
+	quoted := make([]string, 0, len(tests))
+	for _, t := range tests {
+		quoted = append(quoted, regexp.QuoteMeta(t))
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
+
+// testFailure is a failed test found in the `gno test -v` output.
+type testFailure struct {
+	Name   string
+	Output []string
+}
+
+// parseTestOutput returns failed tests of a `gno test -v` output.
+//
+// It looks something like this:
+//
+// ```
+// === RUN   TestFoo
+// --- FAIL: TestFoo (0.00s)
+// output: got 1, want 2
+// FAIL
+// FAIL    ./foo 	0.01s
+// ```
+func parseTestOutput(output string) []*testFailure {
+	var (
+		failures []*testFailure
+		blocks   = map[string][]string{}
+		current  string
+	)
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, "=== RUN"):
+			current = strings.TrimSpace(strings.TrimPrefix(line, "=== RUN"))
+		case strings.HasPrefix(line, "--- FAIL:"):
+			name := strings.Fields(strings.TrimPrefix(line, "--- FAIL:"))
+			if len(name) > 0 {
+				current = name[0]
+				failures = append(failures, &testFailure{Name: current})
+			}
+		case strings.HasPrefix(line, "--- "),
+			strings.HasPrefix(line, "ok "),
+			strings.HasPrefix(line, "FAIL"):
+			current = ""
+		default:
+			if current != "" && strings.TrimSpace(line) != "" {
+				line = strings.TrimPrefix(line, "output: ")
+				blocks[current] = append(blocks[current], line)
+			}
+		}
+	}
+	for _, f := range failures {
+		f.Output = blocks[f.Name]
+	}
+	return failures
+}
+
+var gnoPosRe = regexp.MustCompile(`([\w.-]+\.gno):(\d+)`)
+
+// publishTestDiagnostics keeps failures as the test failures of dir, and
+// publishes the diagnostics of its files along with them. Each failure
+// is reported at the last position in its output pointing to a test file
+// (usually the failing assertion or panic), or at the test function
+// otherwise.
+func (s *server) publishTestDiagnostics(ctx context.Context, dir string, failures []*testFailure) {
+	files, err := ListGnoFiles(dir)
+	if err != nil {
+		slog.Error("test", "err", err)
+		return
+	}
+
+	testFiles := map[string]bool{}
+	testFuncs := map[string]token.Position{}
+	for _, fname := range files {
+		if !isTestFile(fname) {
+			continue
+		}
+		testFiles[fname] = true
+		src, err := s.snapshot.ReadFile(fname)
+		if err != nil {
+			continue
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, fname, src, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && isTestFunc(fd) {
+				testFuncs[fd.Name.Name] = fset.Position(fd.Name.Pos())
+			}
+		}
+	}
+
+	errors := []ErrorInfo{}
+	for _, f := range failures {
+		msg := f.Name + " failed"
+		if len(f.Output) > 0 {
+			msg += ": " + strings.Join(f.Output, "\n")
+		}
+
+		var fname string
+		var line int
+		for _, l := range f.Output {
+			for _, m := range gnoPosRe.FindAllStringSubmatch(l, -1) {
+				abs := filepath.Join(dir, filepath.Base(m[1]))
+				if !testFiles[abs] {
+					continue
+				}
+				fname = abs
+				line, _ = strconv.Atoi(m[2])
+			}
+		}
+		if fname == "" {
+			pos, ok := testFuncs[f.Name]
+			if !ok {
+				continue
+			}
+			fname, line = pos.Filename, pos.Line
+		}
+
+		errors = append(errors, ErrorInfo{
+			FileName: fname,
+			Line:     line,
+			Column:   1,
+			Span:     []int{1, math.MaxInt32},
+			Msg:      msg,
+			Tool:     "test",
+		})
+	}
+
+	s.testFailures.Set(dir, errors)
+	if err := s.publishPackageDiagnostics(ctx, s.conn, dir); err != nil {
+		slog.Error("test", "err", err)
+	}
+	s.refreshDiagnostics(ctx, s.conn)
+}
+
+// lineWriter calls fn for each line written to it.
+type lineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush calls fn with the remaining incomplete line, if any.
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// lastLines returns the last n non empty lines of s.
+func lastLines(s string, n int) string {
+	lines := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
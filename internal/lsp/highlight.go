@@ -0,0 +1,105 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/token"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+func (s *server) DocumentHighlight(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.DocumentHighlightParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	file, ok := s.snapshot.Get(params.TextDocument.URI.Filename())
+	if !ok {
+		return reply(ctx, nil, errors.New("snapshot not found"))
+	}
+	tcr, f, pos, ok := s.typeCheckPosition(file, params.Position)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	_, obj := tcr.identAt(f, pos)
+	if obj == nil {
+		return reply(ctx, nil, nil)
+	}
+
+	writes := writtenIdents(f)
+	highlights := []protocol.DocumentHighlight{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		kind := protocol.DocumentHighlightKindRead
+		switch {
+		case tcr.info.Uses[id] == obj:
+		case tcr.info.Defs[id] == obj:
+			kind = protocol.DocumentHighlightKindText
+		default:
+			return true
+		}
+		if writes[id] {
+			kind = protocol.DocumentHighlightKindWrite
+		}
+		highlights = append(highlights, protocol.DocumentHighlight{
+			Range: tcr.location(id.Pos(), id.End()).Range,
+			Kind:  kind,
+		})
+		return true
+	})
+	return reply(ctx, highlights, nil)
+}
+
+// writtenIdents returns the identifiers of f whose object is written:
+// assigned, incremented or decremented, or whose address is taken. For
+// selectors, e.g. `x.f = 1`, the selected field is written.
+func writtenIdents(f *ast.File) map[*ast.Ident]bool {
+	writes := map[*ast.Ident]bool{}
+	add := func(e ast.Expr) {
+		switch e := astutil.Unparen(e).(type) {
+		case *ast.Ident:
+			writes[e] = true
+		case *ast.SelectorExpr:
+			writes[e.Sel] = true
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, e := range n.Lhs {
+				add(e)
+			}
+		case *ast.IncDecStmt:
+			add(n.X)
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				add(n.X)
+			}
+		case *ast.RangeStmt:
+			if n.Tok != token.ILLEGAL {
+				if n.Key != nil {
+					add(n.Key)
+				}
+				if n.Value != nil {
+					add(n.Value)
+				}
+			}
+		case *ast.ValueSpec:
+			if len(n.Values) > 0 {
+				for _, name := range n.Names {
+					add(name)
+				}
+			}
+		}
+		return true
+	})
+	return writes
+}
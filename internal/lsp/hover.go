@@ -9,7 +9,6 @@ import (
 	"go/token"
 	"go/types"
 	"log/slog"
-	"path/filepath"
 	"strings"
 
 	"go.lsp.dev/jsonrpc2"
@@ -40,8 +39,15 @@ func (s *server) Hover(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2
 	if err != nil {
 		return reply(ctx, nil, errors.New("cannot parse gno file"))
 	}
+	// Handle hovering over filetest directives
+	if isFiletest(uri.Filename()) {
+		if ok, err := hoverDirective(ctx, reply, pgf, int(params.Position.Line)); ok {
+			return err
+		}
+	}
+
 	// Load pkg from cache
-	pkg, ok := s.cache.pkgs.Get(filepath.Dir(string(params.TextDocument.URI.Filename())))
+	pkg, ok := s.cache.lookupPackage(params.TextDocument.URI.Filename())
 	if !ok {
 		return reply(ctx, nil, nil)
 	}
@@ -70,7 +76,7 @@ func (s *server) Hover(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2
 	switch n := paths[0].(type) {
 	case *ast.Ident:
 		_, tv := getTypeAndValue(
-			*pkg.TypeCheckResult.fset,
+			pkg.TypeCheckResult.fset,
 			info, n.Name,
 			int(line),
 			offset,
@@ -164,7 +170,7 @@ func hoverSelectorExpr(ctx context.Context, s *server, reply jsonrpc2.Replier, p
 	parentStr := types.ExprString(parent)
 
 	_, tv := getTypeAndValueLight(
-		*pkg.TypeCheckResult.fset,
+		pkg.TypeCheckResult.fset,
 		pkg.TypeCheckResult.info,
 		exprStr,
 		int(line),
@@ -175,7 +181,7 @@ func hoverSelectorExpr(ctx context.Context, s *server, reply jsonrpc2.Replier, p
 	tvStr := tv.Type.String()
 
 	_, tvParent := getTypeAndValueLight(
-		*pkg.TypeCheckResult.fset,
+		pkg.TypeCheckResult.fset,
 		pkg.TypeCheckResult.info,
 		parentStr,
 		int(line),
@@ -204,7 +210,7 @@ func hoverSelectorExpr(ctx context.Context, s *server, reply jsonrpc2.Replier, p
 					),
 				}, nil)
 			} else if last == parentStr { // hover on package symbol
-				symbol := s.completionStore.lookupSymbol(parentStr, i.Name)
+				symbol := s.completionStore.Load().lookupSymbol(parentStr, i.Name)
 				if symbol == nil {
 					break
 				}
@@ -233,9 +239,7 @@ func hoverSelectorExpr(ctx context.Context, s *server, reply jsonrpc2.Replier, p
 		for _, spec := range pgf.File.Imports {
 			path := spec.Path.Value[1 : len(spec.Path.Value)-1]
 			if strings.Contains(tvParentStr, path) { // hover on parent var of kind import
-				parts := strings.Split(path, "/")
-				last := parts[len(parts)-1]
-				pkg := s.completionStore.lookupPkg(last)
+				pkg := s.storePackage(path)
 				if pkg == nil {
 					break
 				}
@@ -277,7 +281,7 @@ func hoverSelectorExpr(ctx context.Context, s *server, reply jsonrpc2.Replier, p
 				continue
 			}
 			path := spec.Path.Value[1 : len(spec.Path.Value)-1]
-			symbol := s.completionStore.lookupSymbol(path, i.Name)
+			symbol := s.completionStore.Load().lookupSymbol(path, i.Name)
 			if symbol == nil {
 				continue
 			}
@@ -0,0 +1,361 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/types"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func (s *server) TypeDefinition(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.TypeDefinitionParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	file, ok := s.snapshot.Get(params.TextDocument.URI.Filename())
+	if !ok {
+		return reply(ctx, nil, errors.New("snapshot not found"))
+	}
+	tcr, f, pos, ok := s.typeCheckPosition(file, params.Position)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	_, obj := tcr.identAt(f, pos)
+	if obj == nil {
+		return reply(ctx, nil, nil)
+	}
+
+	named := typeNameOf(obj.Type())
+	if named == nil {
+		return reply(ctx, nil, nil)
+	}
+	loc, ok := tcr.objectLocation(named.Obj())
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	return reply(ctx, loc, nil)
+}
+
+// typeNameOf returns the named type of t, looking through pointers,
+// containers and single result functions.
+func typeNameOf(t types.Type) *types.Named {
+	for {
+		switch u := t.(type) {
+		case *types.Named:
+			return u
+		case *types.Pointer:
+			t = u.Elem()
+		case *types.Slice:
+			t = u.Elem()
+		case *types.Array:
+			t = u.Elem()
+		case *types.Map:
+			t = u.Elem()
+		case *types.Chan:
+			t = u.Elem()
+		case *types.Signature:
+			if u.Results().Len() != 1 {
+				return nil
+			}
+			t = u.Results().At(0).Type()
+		default:
+			return nil
+		}
+	}
+}
+
+func (s *server) Implementation(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.ImplementationParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	file, ok := s.snapshot.Get(params.TextDocument.URI.Filename())
+	if !ok {
+		return reply(ctx, nil, errors.New("snapshot not found"))
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	checked := s.comparablePackages(tcr)
+	if len(checked) == 0 {
+		return reply(ctx, nil, nil)
+	}
+	tcr = checked[0]
+	f, pos, ok := tcr.filePosition(file, params.Position)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	_, obj := tcr.identAt(f, pos)
+	if obj == nil {
+		return reply(ctx, nil, nil)
+	}
+
+	pkgs := []*types.Package{}
+	for _, res := range checked {
+		pkgs = append(pkgs, res.pkg)
+	}
+	locations := []protocol.Location{}
+	for _, impl := range implementations(obj, pkgs) {
+		if loc, ok := tcr.objectLocation(impl); ok {
+			locations = append(locations, loc)
+		}
+	}
+	return reply(ctx, locations, nil)
+}
+
+// implementations returns the concrete types implementing the
+// interface obj, or the interfaces implemented by the concrete type
+// obj. For methods, the corresponding methods are returned.
+func implementations(obj types.Object, pkgs []*types.Package) []types.Object {
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		if obj.IsAlias() {
+			return nil
+		}
+		res := []types.Object{}
+		for _, t := range implementingTypes(obj.Type(), pkgs) {
+			res = append(res, t.Obj())
+		}
+		return res
+
+	case *types.Func:
+		recv := obj.Type().(*types.Signature).Recv()
+		if recv == nil {
+			return nil
+		}
+		named := namedOf(recv.Type())
+		if named == nil {
+			return nil
+		}
+		res := []types.Object{}
+		for _, t := range implementingTypes(named, pkgs) {
+			var lookup types.Type = t
+			if !types.IsInterface(t) {
+				lookup = types.NewPointer(t)
+			}
+			m, _, _ := types.LookupFieldOrMethod(lookup, false, obj.Pkg(), obj.Name())
+			if m, ok := m.(*types.Func); ok {
+				res = append(res, m)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// implementingTypes returns the named concrete types of pkgs implementing
+// t if t is an interface, the named interfaces t implements otherwise.
+// Empty interfaces are ignored, as implemented by every type.
+func implementingTypes(t types.Type, pkgs []*types.Package) []*types.Named {
+	iface, isIface := t.Underlying().(*types.Interface)
+	if isIface && iface.Empty() {
+		return nil
+	}
+
+	res := []*types.Named{}
+	for _, pkg := range pkgs {
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			named, ok := tn.Type().(*types.Named)
+			if !ok || types.Identical(named, t) {
+				continue
+			}
+			other, otherIsIface := named.Underlying().(*types.Interface)
+			switch {
+			case isIface && !otherIsIface:
+				if implements(named, iface) {
+					res = append(res, named)
+				}
+			case !isIface && otherIsIface && !other.Empty():
+				if implements(t, other) {
+					res = append(res, named)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// implements reports whether t or *t implements iface.
+func implements(t types.Type, iface *types.Interface) bool {
+	return types.Implements(t, iface) || types.Implements(types.NewPointer(t), iface)
+}
+
+// comparablePackages returns the package of tcr along with every
+// package of the Cache and of the CompletionStore. They are
+// type-checked together, so that their types can be compared: the
+// package of tcr is type-checked again, the objects of tcr must be
+// looked up in the first result.
+func (s *server) comparablePackages(tcr *TypeCheckResult) []*TypeCheckResult {
+	return s.checkPackages(tcr, true)
+}
+
+// cachedPackages returns the package of tcr along with every package of
+// the Cache and the packages they import, type-checked together like
+// comparablePackages.
+func (s *server) cachedPackages(tcr *TypeCheckResult) []*TypeCheckResult {
+	pkgs := s.checkPackages(tcr, false)
+	if len(pkgs) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, res := range pkgs {
+		seen[res.pkg.Path()] = true
+	}
+	paths := []string{}
+	var addImports func(pkg *types.Package)
+	addImports = func(pkg *types.Package) {
+		for _, imp := range pkg.Imports() {
+			if !seen[imp.Path()] {
+				seen[imp.Path()] = true
+				paths = append(paths, imp.Path())
+				addImports(imp)
+			}
+		}
+	}
+	for _, res := range pkgs {
+		addImports(res.pkg)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if res, ok := pkgs[0].tc.cache.Get(path); ok && res.pkg != nil {
+			pkgs = append(pkgs, res)
+		}
+	}
+	return pkgs
+}
+
+// workspaceCheck are the packages of the Cache, and of the
+// CompletionStore once needed, type-checked with the same importer.
+// It is valid for a generation of the Cache and a CompletionStore.
+type workspaceCheck struct {
+	generation uint64
+	store      *CompletionStore
+
+	tc        *TypeCheck
+	pkgs      []*TypeCheckResult // nil until checked
+	storePkgs []*TypeCheckResult // nil until checked
+}
+
+// checkPackages returns the package of tcr type-checked again along
+// with every package of the Cache, and of the CompletionStore if
+// withStore is set. The importer of tcr is left untouched.
+func (s *server) checkPackages(tcr *TypeCheckResult, withStore bool) []*TypeCheckResult {
+	if tcr.pkg == nil || tcr.pkginfo == nil {
+		return nil
+	}
+	tc, others := s.workspacePackages(withStore)
+	res := typeCheckWith(tcr.pkginfo, tc.cache)
+	if res.pkg == nil {
+		return nil
+	}
+	pkgs := []*TypeCheckResult{res}
+	for _, other := range others {
+		if other.pkg.Path() != res.pkg.Path() {
+			pkgs = append(pkgs, other)
+		}
+	}
+	return pkgs
+}
+
+// workspacePackages returns the packages of the Cache, and of the
+// CompletionStore if withStore is set, along with their importer. They
+// are type-checked on first use, once for the current Cache and
+// CompletionStore.
+func (s *server) workspacePackages(withStore bool) (*TypeCheck, []*TypeCheckResult) {
+	s.workspaceMu.Lock()
+	defer s.workspaceMu.Unlock()
+
+	generation, store := s.cache.generation.Load(), s.completionStore.Load()
+	ws := s.workspace
+	if ws == nil || ws.generation != generation || ws.store != store {
+		tc, _ := NewTypeCheck()
+		tc.cfg.Importer = tc // set typeCheck importer
+		ws = &workspaceCheck{generation: generation, store: store, tc: tc}
+		s.workspace = ws
+	}
+
+	seen := map[string]bool{}
+	check := func(path string, getInfo func() (*PackageInfo, error)) *TypeCheckResult {
+		if path == "" || seen[path] {
+			return nil
+		}
+		seen[path] = true
+		res, ok := ws.tc.cache.Get(path)
+		if !ok {
+			pi, err := getInfo()
+			if err != nil {
+				res = &TypeCheckResult{err: err}
+			} else {
+				res = pi.TypeCheck(ws.tc)
+			}
+			ws.tc.cache.Set(path, res)
+		}
+		if res.pkg == nil {
+			return nil
+		}
+		return res
+	}
+
+	if ws.pkgs == nil {
+		ws.pkgs = []*TypeCheckResult{}
+		for _, pkg := range s.cache.pkgs.Items() {
+			if pkg.TypeCheckResult == nil || pkg.TypeCheckResult.pkginfo == nil {
+				continue
+			}
+			pi := pkg.TypeCheckResult.pkginfo
+			if res := check(pi.ImportPath, func() (*PackageInfo, error) { return pi, nil }); res != nil {
+				ws.pkgs = append(ws.pkgs, res)
+			}
+		}
+	}
+	if !withStore {
+		return ws.tc, slices.Clip(ws.pkgs)
+	}
+	if ws.storePkgs == nil {
+		for _, res := range ws.pkgs {
+			seen[res.pkg.Path()] = true
+		}
+		ws.storePkgs = []*TypeCheckResult{}
+		for _, pkg := range store.pkgs {
+			path := s.storeImportPath(pkg)
+			res := check(path, func() (*PackageInfo, error) {
+				pi, err := getPackageInfo(pkg.Dir)
+				if err != nil {
+					return nil, err
+				}
+				pi.ImportPath = path
+				return pi, nil
+			})
+			if res != nil {
+				ws.storePkgs = append(ws.storePkgs, res)
+			}
+		}
+	}
+	return ws.tc, append(slices.Clip(ws.pkgs), ws.storePkgs...)
+}
+
+// storeImportPath returns the import path of the indexed package pkg.
+// Packages of `stdlibs` don't have a gno.mod, their import path is
+// their location in `stdlibs`.
+func (s *server) storeImportPath(pkg *Package) string {
+	stdlibs := filepath.Join(s.env.GNOROOT, "gnovm", "stdlibs")
+	if rel, err := filepath.Rel(stdlibs, pkg.Dir); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return pkg.ImportPath
+}
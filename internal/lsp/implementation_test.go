@@ -0,0 +1,86 @@
+package lsp
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestImplementation(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/p/demo/bar/gno.mod": "module gno.land/p/demo/bar\n",
+		"gno.land/p/demo/bar/bar.gno": `package bar
+
+type /*iface*/Renderer interface {
+	Render(path string) string
+}
+`,
+		"gno.land/r/demo/foo/gno.mod": "module gno.land/r/demo/foo\n",
+		"gno.land/r/demo/foo/foo.gno": `package foo
+
+type /*impl*/T struct{}
+
+func (T) Render(path string) string { return path }
+`,
+	})
+	pkg, _ := s.cache.pkgs.Get(filepath.Dir(locs["iface"].URI.Filename()))
+	imported := pkg.TypeCheckResult.tc.cache.Keys()
+	slices.Sort(imported)
+
+	var got []protocol.Location
+	err := request(t, s, "textDocument/implementation", protocol.ImplementationParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: locs["iface"].URI},
+			Position:     locs["iface"].Range.Start,
+		},
+	}, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := locs["impl"]
+	want.Range.End.Character += uint32(len("T"))
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("implementations = %v, want %v", got, want)
+	}
+
+	// The importer of the package is left untouched
+	keys := pkg.TypeCheckResult.tc.cache.Keys()
+	slices.Sort(keys)
+	if !slices.Equal(keys, imported) {
+		t.Errorf("imported packages = %v, want %v", keys, imported)
+	}
+}
+
+func TestCheckPackagesReused(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/p/demo/bar/gno.mod": "module gno.land/p/demo/bar\n",
+		"gno.land/p/demo/bar/bar.gno": "package bar\n\n/*use*/var X int\n",
+		"gno.land/r/demo/foo/gno.mod": "module gno.land/r/demo/foo\n",
+		"gno.land/r/demo/foo/foo.gno": "package foo\n\n/*foo*/var Y int\n",
+	})
+	file, _ := s.snapshot.Get(locs["use"].URI.Filename())
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		t.Fatal("cannot type-check")
+	}
+	other := func() *TypeCheckResult {
+		for _, res := range s.checkPackages(tcr, false) {
+			if res.pkg.Path() == "gno.land/r/demo/foo" {
+				return res
+			}
+		}
+		t.Fatal("gno.land/r/demo/foo not checked")
+		return nil
+	}
+
+	first := other()
+	if other() != first {
+		t.Error("packages checked again for the same Cache")
+	}
+	s.UpdateCache(filepath.Dir(locs["foo"].URI.Filename()))
+	if other() == first {
+		t.Error("packages not checked again after an update of the Cache")
+	}
+}
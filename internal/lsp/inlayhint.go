@@ -0,0 +1,211 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+
+	"go.lsp.dev/jsonrpc2"
+)
+
+func (s *server) InlayHint(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params inlayHintParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	uri := params.TextDocument.URI
+	file, ok := s.snapshot.Get(uri.Filename())
+	if !ok {
+		return reply(ctx, nil, errors.New("snapshot not found"))
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	f, _ := tcr.file(filepath.Base(uri.Filename()))
+	if f == nil {
+		return reply(ctx, nil, nil)
+	}
+
+	hints := []inlayHint{}
+	add := func(pos token.Pos, hint inlayHint) {
+		hint.Position = tcr.location(pos, pos).Range.Start
+		if positionLess(hint.Position, params.Range.Start) || positionLess(params.Range.End, hint.Position) {
+			return
+		}
+		hints = append(hints, hint)
+	}
+	enabled := s.settings.Hints
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if enabled.ParameterNames {
+				parameterNameHints(tcr, n, add)
+			}
+		case *ast.AssignStmt:
+			if enabled.AssignVariableTypes && n.Tok == token.DEFINE {
+				variableTypeHints(tcr, n.Lhs, add)
+			}
+		case *ast.RangeStmt:
+			if enabled.AssignVariableTypes && n.Tok == token.DEFINE {
+				variableTypeHints(tcr, []ast.Expr{n.Key, n.Value}, add)
+			}
+		case *ast.GenDecl:
+			if enabled.ConstantValues && n.Tok == token.CONST {
+				constantValueHints(tcr, n, add)
+			}
+			if enabled.PersistedState && n.Tok == token.VAR {
+				persistedStateHints(tcr, n, add)
+			}
+		case *ast.CompositeLit:
+			if enabled.CompositeLiteralFields {
+				compositeLiteralFieldHints(tcr, n, add)
+			}
+		}
+		return true
+	})
+	return reply(ctx, hints, nil)
+}
+
+// parameterNameHints adds the names of the parameters before the
+// arguments of call. The name is omitted when the argument has the same
+// name.
+func parameterNameHints(tcr *TypeCheckResult, call *ast.CallExpr, add func(token.Pos, inlayHint)) {
+	tv, ok := tcr.info.Types[call.Fun]
+	if !ok || tv.IsType() || tv.IsBuiltin() {
+		return
+	}
+	sig, ok := typeUnder[*types.Signature](tv.Type)
+	if !ok {
+		return
+	}
+	params := sig.Params()
+	for i, arg := range call.Args {
+		if _, ok := tcr.info.TypeOf(arg).(*types.Tuple); ok {
+			return // e.g. f(g()), g returning multiple values
+		}
+		if i >= params.Len() {
+			return
+		}
+		suffix := ""
+		if sig.Variadic() && i >= params.Len()-1 {
+			if i > params.Len()-1 {
+				return // only the first variadic argument is named
+			}
+			if !call.Ellipsis.IsValid() {
+				suffix = "..."
+			}
+		}
+		name := params.At(i).Name()
+		if name == "" || name == "_" {
+			continue
+		}
+		if id, ok := arg.(*ast.Ident); ok && id.Name == name {
+			continue
+		}
+		add(arg.Pos(), inlayHint{
+			Label:        name + suffix + ":",
+			Kind:         inlayHintKindParameter,
+			PaddingRight: true,
+		})
+	}
+}
+
+// variableTypeHints adds the types of the variables declared by lhs.
+func variableTypeHints(tcr *TypeCheckResult, lhs []ast.Expr, add func(token.Pos, inlayHint)) {
+	for _, e := range lhs {
+		id, ok := e.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		// Defs is nil for redeclared variables
+		obj := tcr.info.Defs[id]
+		if obj == nil {
+			continue
+		}
+		add(id.End(), inlayHint{
+			Label:       types.TypeString(obj.Type(), types.RelativeTo(tcr.pkg)),
+			Kind:        inlayHintKindType,
+			PaddingLeft: true,
+		})
+	}
+}
+
+// constantValueHints adds the values of the constants of decl which are
+// not declared with a literal, e.g. using `iota`.
+func constantValueHints(tcr *TypeCheckResult, decl *ast.GenDecl, add func(token.Pos, inlayHint)) {
+	for _, spec := range decl.Specs {
+		spec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		for i, name := range spec.Names {
+			if i < len(spec.Values) {
+				if _, ok := spec.Values[i].(*ast.BasicLit); ok {
+					continue
+				}
+			}
+			c, ok := tcr.info.Defs[name].(*types.Const)
+			if !ok || name.Name == "_" {
+				continue
+			}
+			add(name.End(), inlayHint{
+				Label:       "= " + c.Val().ExactString(),
+				PaddingLeft: true,
+			})
+		}
+	}
+}
+
+// persistedStateHints marks the package-level variables of realms, as
+// their state is persisted between transactions.
+func persistedStateHints(tcr *TypeCheckResult, decl *ast.GenDecl, add func(token.Pos, inlayHint)) {
+	if tcr.pkg == nil || !isRealm(tcr.pkg.Path()) {
+		return
+	}
+	for _, spec := range decl.Specs {
+		spec, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		for _, name := range spec.Names {
+			obj := tcr.info.Defs[name]
+			if obj == nil || obj.Parent() != tcr.pkg.Scope() {
+				continue
+			}
+			add(name.End(), inlayHint{
+				Label:       "persisted",
+				Tooltip:     "Package-level variables of realms are persisted on-chain.",
+				PaddingLeft: true,
+			})
+		}
+	}
+}
+
+// compositeLiteralFieldHints adds the field names of the elements of
+// lit, if it is an unkeyed struct literal.
+func compositeLiteralFieldHints(tcr *TypeCheckResult, lit *ast.CompositeLit, add func(token.Pos, inlayHint)) {
+	t := tcr.info.TypeOf(lit)
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem() // elided `&T` in a literal of []*T
+	}
+	st, ok := typeUnder[*types.Struct](t)
+	if !ok {
+		return
+	}
+	for i, elt := range lit.Elts {
+		if _, ok := elt.(*ast.KeyValueExpr); ok || i >= st.NumFields() {
+			return
+		}
+		add(elt.Pos(), inlayHint{
+			Label:        st.Field(i).Name() + ":",
+			Kind:         inlayHintKindParameter,
+			PaddingRight: true,
+		})
+	}
+}
@@ -0,0 +1,648 @@
+package lsp
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// codeActionsInline returns the `refactor.inline` code actions available
+// at the start of rng in file.
+func (s *server) codeActionsInline(file *GnoFile, rng protocol.Range) []protocol.CodeAction {
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil
+	}
+	f, tf := tcr.file(filepath.Base(file.URI.Filename()))
+	if f == nil {
+		return nil
+	}
+	pos := posFromPosition(tf, rng.Start)
+	if !pos.IsValid() {
+		return nil
+	}
+	rf := &refactoring{tcr: tcr, f: f, tf: tf, src: file.Src, start: pos, end: pos}
+
+	actions := []protocol.CodeAction{}
+	add := func(title string, src []byte) {
+		edit, err := s.formattedEdit(file.URI, src)
+		if err != nil {
+			return
+		}
+		actions = append(actions, protocol.CodeAction{
+			Title: title,
+			Kind:  protocol.RefactorInline,
+			Edit:  edit,
+		})
+	}
+	if src, ok := rf.inlineVariable(); ok {
+		add("Inline variable", src)
+	}
+	if src, ok := rf.inlineCall(); ok {
+		add("Inline call", src)
+	}
+	return actions
+}
+
+// inlineVariable returns the source with every use of the local variable
+// at the selection replaced by its initializer, and its declaration
+// removed. The variable must be assigned once, by its declaration, and
+// its initializer must have no side effects.
+func (rf *refactoring) inlineVariable() ([]byte, bool) {
+	info := rf.tcr.info
+	_, obj := rf.tcr.identAt(rf.f, rf.start)
+	v, ok := obj.(*types.Var)
+	if !ok || v.IsField() || v.Pkg() != rf.tcr.pkg || v.Parent() == rf.tcr.pkg.Scope() || !rf.inFile(v.Pos()) {
+		return nil, false
+	}
+
+	// Find the declaration, `v := init` or `var v = init`
+	path, _ := astutil.PathEnclosingInterval(rf.f, v.Pos(), v.Pos())
+	var stmt ast.Stmt
+	var init ast.Expr
+	var parent ast.Node
+	switch decl := path[1].(type) {
+	case *ast.AssignStmt:
+		if decl.Tok == token.DEFINE && len(decl.Lhs) == 1 && len(decl.Rhs) == 1 {
+			stmt, init, parent = decl, decl.Rhs[0], path[2]
+		}
+	case *ast.ValueSpec:
+		if len(decl.Names) == 1 && len(decl.Values) == 1 && len(path) > 4 {
+			if gen, ok := path[2].(*ast.GenDecl); ok && len(gen.Specs) == 1 {
+				stmt, init, parent = path[3].(ast.Stmt), decl.Values[0], path[4]
+			}
+		}
+	}
+	if stmt == nil {
+		return nil, false
+	}
+	if _, ok := stmtList(parent); !ok {
+		return nil, false // e.g. `if v := init; ...`
+	}
+
+	if mutatedVars(info, rf.f)[v] {
+		return nil, false
+	}
+	var uses []*ast.Ident
+	for id, obj := range info.Uses {
+		if obj == v {
+			uses = append(uses, id)
+		}
+	}
+	if len(uses) == 0 || !isPure(init, info) {
+		return nil, false
+	}
+	if len(uses) > 1 && !isDuplicable(init) {
+		return nil, false
+	}
+	sort.Slice(uses, func(i, j int) bool { return uses[i].Pos() < uses[j].Pos() })
+
+	// The identifiers of init must denote the same objects at every use,
+	// and what init reads must not change in between.
+	last := uses[len(uses)-1]
+	for _, id := range freeIdents(init) {
+		obj := info.Uses[id]
+		for _, use := range uses {
+			if lookup(rf.tcr.pkg, id.Name, use.Pos()) != obj {
+				return nil, false
+			}
+		}
+	}
+	// A use in a loop not containing the declaration is evaluated again
+	// after the rest of the loop body.
+	end := last.End()
+	for _, use := range uses {
+		path, _ := astutil.PathEnclosingInterval(rf.f, use.Pos(), use.End())
+		for _, n := range path {
+			if n.Pos() <= stmt.Pos() {
+				break
+			}
+			switch n.(type) {
+			case *ast.ForStmt, *ast.RangeStmt:
+				end = max(end, n.End())
+			}
+		}
+	}
+	if rf.changedBetween(init, stmt.End(), end) {
+		return nil, false
+	}
+
+	text := rf.text(init.Pos(), init.End())
+	if needsConversion(init, info, v.Type()) {
+		// e.g. `var x float64 = 1`
+		text = types.TypeString(v.Type(), types.RelativeTo(rf.tcr.pkg)) + "(" + text + ")"
+	}
+	replacements := []replacement{rf.stmtLines(stmt)}
+	for _, use := range uses {
+		path, _ := astutil.PathEnclosingInterval(rf.f, use.Pos(), use.End())
+		replacements = append(replacements, replacement{use.Pos(), use.End(), parenthesize(text, init, path[1], use)})
+	}
+	return rf.splice(replacements...), true
+}
+
+// changedBetween reports whether what init reads may change in
+// [from, to): one of its variables written, even through a field, an
+// element or a pointer, or its address taken, or any call with side
+// effects if init reads memory calls can reach.
+func (rf *refactoring) changedBetween(init ast.Expr, from, to token.Pos) bool {
+	info := rf.tcr.info
+	vars := map[types.Object]bool{}
+	for _, id := range freeIdents(init) {
+		if v, ok := info.Uses[id].(*types.Var); ok {
+			vars[v] = true
+		}
+	}
+	shared := rf.readsShared(init, vars)
+
+	changed := false
+	write := func(e ast.Expr) {
+		if id := rootIdent(e); id != nil && vars[info.Uses[id]] {
+			changed = true
+		}
+	}
+	ast.Inspect(rf.f, func(n ast.Node) bool {
+		if n == nil || changed || n.End() <= from || to <= n.Pos() {
+			return false
+		}
+		if n.Pos() < from || to < n.End() {
+			return true // partially in the range
+		}
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				write(lhs)
+			}
+		case *ast.IncDecStmt:
+			write(n.X)
+		case *ast.RangeStmt:
+			if n.Tok == token.ASSIGN {
+				if n.Key != nil {
+					write(n.Key)
+				}
+				if n.Value != nil {
+					write(n.Value)
+				}
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				write(n.X)
+			}
+		case *ast.SelectorExpr:
+			if sel, ok := info.Selections[n]; ok && sel.Kind() == types.MethodVal {
+				recv := sel.Obj().Type().(*types.Signature).Recv()
+				if _, ptr := recv.Type().(*types.Pointer); ptr {
+					write(n.X)
+				}
+			}
+		case *ast.CallExpr:
+			if shared && !isPure(n, info) {
+				changed = true
+			}
+		}
+		return !changed
+	})
+	return changed
+}
+
+// readsShared reports whether init reads memory that calls may modify:
+// through a pointer, a slice or a map, or a variable of vars which is a
+// package-level one, captured by a closure or whose address is taken.
+func (rf *refactoring) readsShared(init ast.Expr, vars map[types.Object]bool) bool {
+	info := rf.tcr.info
+	shared := false
+	ast.Inspect(init, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.StarExpr:
+			shared = true
+		case *ast.IndexExpr:
+			if t := info.TypeOf(n.X); t != nil {
+				switch t.Underlying().(type) {
+				case *types.Array, *types.Basic: // strings are immutable
+				default:
+					shared = true
+				}
+			}
+		case *ast.SelectorExpr:
+			if sel, ok := info.Selections[n]; ok && sel.Indirect() {
+				shared = true
+			}
+		}
+		return !shared
+	})
+	if shared {
+		return true
+	}
+
+	for obj := range vars {
+		if obj.Parent() == rf.tcr.pkg.Scope() {
+			return true
+		}
+	}
+	ast.Inspect(rf.f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			for _, id := range freeIdents(n.Body) {
+				if vars[info.Uses[id]] {
+					shared = true
+				}
+			}
+		case *ast.UnaryExpr:
+			if id := rootIdent(n.X); n.Op == token.AND && id != nil && vars[info.Uses[id]] {
+				shared = true
+			}
+		}
+		return !shared
+	})
+	return shared
+}
+
+// rootIdent returns the variable identifier e selects, indexes or
+// dereferences, e.g. x for `x.f[i]` or `*x`.
+func rootIdent(e ast.Expr) *ast.Ident {
+	for {
+		switch x := astutil.Unparen(e).(type) {
+		case *ast.Ident:
+			return x
+		case *ast.SelectorExpr:
+			e = x.X
+		case *ast.IndexExpr:
+			e = x.X
+		case *ast.StarExpr:
+			e = x.X
+		default:
+			return nil
+		}
+	}
+}
+
+// inlineCall returns the source with the call at the selection replaced
+// by the body of the called function, its parameters replaced by the
+// arguments. The function must be declared in the package, and its body
+// must be a single statement: a `return` of one value, or any statement
+// if the call is itself a statement.
+func (rf *refactoring) inlineCall() ([]byte, bool) {
+	info := rf.tcr.info
+	path, _ := astutil.PathEnclosingInterval(rf.f, rf.start, rf.start)
+	var call *ast.CallExpr
+	var parent ast.Node
+	for i, n := range path[:len(path)-1] {
+		if c, ok := n.(*ast.CallExpr); ok && c.Fun.Pos() <= rf.start && rf.start <= c.Fun.End() {
+			call, parent = c, path[i+1]
+			break
+		}
+	}
+	if call == nil || call.Ellipsis.IsValid() {
+		return nil, false
+	}
+	var fn *types.Func
+	switch fun := astutil.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		fn, _ = info.Uses[fun].(*types.Func)
+	case *ast.SelectorExpr:
+		fn, _ = info.Uses[fun.Sel].(*types.Func)
+	}
+	if fn == nil || fn.Pkg() != rf.tcr.pkg {
+		return nil, false
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Recv() != nil || sig.Variadic() {
+		return nil, false
+	}
+	decl := funcDecl(rf.tcr, fn.FullName())
+	if decl == nil || decl.Body == nil || len(decl.Body.List) != 1 || decl.Type.TypeParams != nil {
+		return nil, false
+	}
+
+	// The replaced node and the replacing one
+	var target, body ast.Node
+	switch stmt := decl.Body.List[0].(type) {
+	case *ast.ReturnStmt:
+		if sig.Results().Len() != 1 || len(stmt.Results) != 1 {
+			return nil, false
+		}
+		target, body = call, stmt.Results[0]
+	default:
+		if sig.Results().Len() != 0 {
+			return nil, false
+		}
+		if es, ok := parent.(*ast.ExprStmt); !ok || es.X != call {
+			return nil, false
+		}
+		target, body = parent, stmt
+	}
+
+	tf := rf.tcr.fset.File(decl.Pos())
+	var calleeFile *ast.File
+	for _, file := range rf.tcr.files {
+		if file.Pos() <= decl.Pos() && decl.End() <= file.End() {
+			calleeFile = file
+		}
+	}
+	src := rf.tcr.source(tf.Name())
+	if tf == nil || calleeFile == nil || src == nil {
+		return nil, false
+	}
+	calleeWrites := mutatedVars(info, body)
+
+	// Parameters uses, the other identifiers of the body must denote the
+	// same objects at the call site.
+	params := map[*types.Var]int{}
+	for i := 0; i < sig.Params().Len(); i++ {
+		params[sig.Params().At(i)] = i
+	}
+	uses := make([][]*ast.Ident, sig.Params().Len())
+	ok := true
+	ast.Inspect(body, func(n ast.Node) bool {
+		id, isIdent := n.(*ast.Ident)
+		if !isIdent {
+			return ok
+		}
+		if info.Defs[id] != nil {
+			ok = false // shadowing parameters or locals
+			return false
+		}
+		obj := info.Uses[id]
+		if v, isVar := obj.(*types.Var); isVar {
+			if i, isParam := params[v]; isParam {
+				if calleeWrites[v] {
+					ok = false
+				}
+				uses[i] = append(uses[i], id)
+				return ok
+			}
+		}
+		return ok
+	})
+	if !ok {
+		return nil, false
+	}
+	for _, id := range freeIdents(body) {
+		obj := info.Uses[id]
+		if v, isVar := obj.(*types.Var); isVar {
+			if _, isParam := params[v]; isParam {
+				continue
+			}
+		}
+		if !sameObject(lookup(rf.tcr.pkg, id.Name, call.Pos()), obj) {
+			return nil, false
+		}
+	}
+
+	// Arguments are evaluated once, before the body: an argument with
+	// side effects must be used once, by a body without side effects.
+	impure := 0
+	for i, arg := range call.Args {
+		if i >= len(uses) {
+			return nil, false
+		}
+		if !isPure(arg, info) {
+			impure++
+			if len(uses[i]) != 1 {
+				return nil, false
+			}
+		} else if len(uses[i]) > 1 && !isDuplicable(arg) {
+			return nil, false
+		}
+	}
+	if impure > 1 || (impure == 1 && !isPure(body, info)) {
+		return nil, false
+	}
+
+	// Substitute the parameters
+	parents := parentsOf(body)
+	var subst []replacement
+	for i, arg := range call.Args {
+		text := rf.text(arg.Pos(), arg.End())
+		if needsConversion(arg, info, sig.Params().At(i).Type()) {
+			// Keep the type of the parameter, e.g. for `x / 2`
+			text = types.TypeString(sig.Params().At(i).Type(), types.RelativeTo(rf.tcr.pkg)) + "(" + text + ")"
+		}
+		for _, id := range uses[i] {
+			subst = append(subst, replacement{id.Pos(), id.End(), parenthesize(text, arg, parents[id], id)})
+		}
+	}
+	sort.Slice(subst, func(i, j int) bool { return subst[i].pos < subst[j].pos })
+	var b strings.Builder
+	last := tf.Offset(body.Pos())
+	for _, r := range subst {
+		b.Write(src[last:tf.Offset(r.pos)])
+		b.WriteString(r.text)
+		last = tf.Offset(r.end)
+	}
+	b.Write(src[last:tf.Offset(body.End())])
+	text := b.String()
+
+	if e, ok := body.(ast.Expr); ok {
+		if t := sig.Results().At(0).Type(); !types.Identical(info.TypeOf(e), t) {
+			text = types.TypeString(t, types.RelativeTo(rf.tcr.pkg)) + "(" + text + ")"
+		} else {
+			text = parenthesize(text, e, parent, call)
+		}
+	}
+	return rf.splice(replacement{target.Pos(), target.End(), text}), true
+}
+
+// inFile reports whether pos is in the file of rf.
+func (rf *refactoring) inFile(pos token.Pos) bool {
+	return rf.tf.Base() <= int(pos) && int(pos) <= rf.tf.Base()+rf.tf.Size()
+}
+
+// stmtLines returns the removal of stmt, along with its line if it is
+// alone on it.
+func (rf *refactoring) stmtLines(stmt ast.Stmt) replacement {
+	start, end := stmt.Pos(), stmt.End()
+	line := rf.tf.LineStart(rf.tf.Line(start))
+	if strings.TrimSpace(rf.text(line, start)) == "" {
+		start = line
+		if off := rf.offset(end); off < len(rf.src) && rf.src[off] == '\n' {
+			end++
+		}
+	}
+	return replacement{start, end, ""}
+}
+
+// source returns the content of the file name of tcr.
+func (tcr *TypeCheckResult) source(name string) []byte {
+	if tcr.pkginfo == nil {
+		return nil
+	}
+	for _, f := range tcr.pkginfo.Files {
+		if f.Name == name {
+			return []byte(f.Body)
+		}
+	}
+	return nil
+}
+
+// needsConversion reports whether e must be converted to keep the type t
+// once moved: if it is of another type, or an untyped constant whose
+// default type is not t.
+func needsConversion(e ast.Expr, info *types.Info, t types.Type) bool {
+	tv, ok := info.Types[e]
+	if !ok {
+		return false
+	}
+	if !types.Identical(tv.Type, t) {
+		return true
+	}
+	if tv.Value == nil {
+		return false
+	}
+	// Constants are recorded with their final type
+	switch e := astutil.Unparen(e).(type) {
+	case *ast.BasicLit:
+		def := map[token.Token]types.BasicKind{
+			token.INT:    types.Int,
+			token.FLOAT:  types.Float64,
+			token.IMAG:   types.Complex128,
+			token.CHAR:   types.Rune,
+			token.STRING: types.String,
+		}[e.Kind]
+		return !types.Identical(types.Typ[def], t)
+	case *ast.Ident:
+		c, ok := info.Uses[e].(*types.Const)
+		return !ok || !types.Identical(c.Type(), t)
+	}
+	return true
+}
+
+// isPure reports whether evaluating n has no side effects: it makes no
+// calls, except conversions and builtins without side effects, and no
+// channel receives.
+func isPure(n ast.Node, info *types.Info) bool {
+	pure := true
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false // not run when evaluated
+		case *ast.CallExpr:
+			if tv, ok := info.Types[n.Fun]; ok && tv.IsType() {
+				break
+			}
+			if id, ok := astutil.Unparen(n.Fun).(*ast.Ident); ok {
+				if b, ok := info.Uses[id].(*types.Builtin); ok {
+					switch b.Name() {
+					case "len", "cap", "min", "max", "real", "imag", "complex":
+						return pure
+					}
+				}
+			}
+			pure = false
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW {
+				pure = false
+			}
+		}
+		return pure
+	})
+	return pure
+}
+
+// isDuplicable reports whether e can be evaluated several times without
+// changing the meaning of the program: it doesn't create values with an
+// identity, like pointers, maps, slices or closures.
+func isDuplicable(e ast.Expr) bool {
+	ok := true
+	ast.Inspect(e, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CompositeLit, *ast.FuncLit:
+			ok = false
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				ok = false
+			}
+		}
+		return ok
+	})
+	return ok
+}
+
+// freeIdents returns the identifiers of n resolved in its scope, i.e.
+// excluding selected fields and methods, and composite literal keys.
+func freeIdents(n ast.Node) []*ast.Ident {
+	var ids []*ast.Ident
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, func(n ast.Node) bool {
+				ids = append(ids, freeIdents(n)...)
+				return false
+			})
+			return false
+		case *ast.KeyValueExpr:
+			if _, ok := n.Key.(*ast.Ident); !ok {
+				ids = append(ids, freeIdents(n.Key)...)
+			}
+			ids = append(ids, freeIdents(n.Value)...)
+			return false
+		case *ast.Ident:
+			ids = append(ids, n)
+		}
+		return true
+	})
+	return ids
+}
+
+// lookup returns the object name denotes at pos in pkg.
+func lookup(pkg *types.Package, name string, pos token.Pos) types.Object {
+	scope := pkg.Scope().Innermost(pos)
+	if scope == nil {
+		scope = pkg.Scope()
+	}
+	_, obj := scope.LookupParent(name, pos)
+	return obj
+}
+
+// sameObject reports whether a and b are the same object, or import the
+// same package.
+func sameObject(a, b types.Object) bool {
+	if pa, ok := a.(*types.PkgName); ok {
+		pb, ok := b.(*types.PkgName)
+		return ok && pa.Imported() == pb.Imported()
+	}
+	return a == b
+}
+
+// parenthesize returns text, the source of e, parenthesized if needed to
+// replace the operand child of parent.
+func parenthesize(text string, e ast.Expr, parent ast.Node, child ast.Node) string {
+	switch e.(type) {
+	case *ast.BinaryExpr, *ast.UnaryExpr, *ast.StarExpr:
+	default:
+		return text
+	}
+	switch parent := parent.(type) {
+	case *ast.BinaryExpr, *ast.UnaryExpr, *ast.StarExpr, *ast.SelectorExpr,
+		*ast.IndexExpr, *ast.SliceExpr, *ast.TypeAssertExpr:
+		return "(" + text + ")"
+	case *ast.CallExpr:
+		if parent.Fun == child {
+			return "(" + text + ")"
+		}
+	}
+	return text
+}
+
+// parentsOf returns the parent of each node within n.
+func parentsOf(n ast.Node) map[ast.Node]ast.Node {
+	parents := map[ast.Node]ast.Node{}
+	var stack []ast.Node
+	ast.Inspect(n, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		if len(stack) > 0 {
+			parents[n] = stack[len(stack)-1]
+		}
+		stack = append(stack, n)
+		return true
+	})
+	return parents
+}
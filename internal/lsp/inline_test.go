@@ -0,0 +1,299 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineVariable(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // line of the result, refused if empty
+	}{
+		{
+			name: "value",
+			src: `package foo
+
+func F(a, b int) int {
+	/*start*/x := a + b/*end*/
+	return x * 2
+}
+`,
+			want: "return (a + b) * 2",
+		},
+		{
+			name: "element read after the write",
+			src: `package foo
+
+func F(a []int) int {
+	/*start*/x := a[0]/*end*/
+	a[0] = 5
+	return x
+}
+`,
+		},
+		{
+			name: "array element written",
+			src: `package foo
+
+func F() int {
+	var a [2]int
+	/*start*/x := a[0]/*end*/
+	a[0] = 5
+	return x
+}
+`,
+		},
+		{
+			name: "field written",
+			src: `package foo
+
+type S struct{ n int }
+
+func F(s S) int {
+	/*start*/y := s.n/*end*/
+	s.n = 6
+	return y
+}
+`,
+		},
+		{
+			name: "field written through pointer",
+			src: `package foo
+
+type S struct{ n int }
+
+func F(s *S) int {
+	/*start*/y := s.n/*end*/
+	s.n = 6
+	return y
+}
+`,
+		},
+		{
+			name: "field incremented",
+			src: `package foo
+
+type S struct{ n int }
+
+func F(s S) int {
+	/*start*/y := s.n/*end*/
+	s.n++
+	return y
+}
+`,
+		},
+		{
+			name: "pointer method call",
+			src: `package foo
+
+type C struct{ n int }
+
+func (c *C) Inc() { c.n++ }
+
+func F() int {
+	var c C
+	/*start*/y := c.n/*end*/
+	c.Inc()
+	return y
+}
+`,
+		},
+		{
+			name: "call through pointer",
+			src: `package foo
+
+type C struct{ n int }
+
+var global = &C{}
+
+func bump() { global.n++ }
+
+func F(c *C) int {
+	/*start*/y := c.n/*end*/
+	bump()
+	return y
+}
+`,
+		},
+		{
+			name: "call modifying package variable",
+			src: `package foo
+
+var count int
+
+func bump() { count++ }
+
+func F() int {
+	/*start*/y := count/*end*/
+	bump()
+	return y
+}
+`,
+		},
+		{
+			name: "call modifying captured variable",
+			src: `package foo
+
+func F() int {
+	n := 1
+	inc := func() { n++ }
+	/*start*/y := n/*end*/
+	inc()
+	return y
+}
+`,
+		},
+		{
+			name: "address taken",
+			src: `package foo
+
+func set(p *int) { *p = 2 }
+
+func F() int {
+	n := 1
+	/*start*/y := n/*end*/
+	set(&n)
+	return y
+}
+`,
+		},
+		{
+			name: "variable written in place",
+			src: `package foo
+
+type S struct{ n int }
+
+func F(a S) int {
+	/*start*/s := a/*end*/
+	s.n = 2
+	return s.n + a.n
+}
+`,
+		},
+		{
+			name: "call not reaching a local",
+			src: `package foo
+
+func g() {}
+
+func F(a int) int {
+	/*start*/y := a + 1/*end*/
+	g()
+	return y
+}
+`,
+			want: "return a + 1",
+		},
+		{
+			name: "write after the last use",
+			src: `package foo
+
+type S struct{ n int }
+
+func F(s S) int {
+	/*start*/y := s.n/*end*/
+	r := y
+	s.n = 6
+	return r + s.n
+}
+`,
+			want: "r := s.n",
+		},
+		{
+			name: "write after the use in a loop",
+			src: `package foo
+
+func F(a int, xs []int) int {
+	s := 0
+	/*start*/x := a/*end*/
+	for range xs {
+		s += x
+		a = 5
+	}
+	return s
+}
+`,
+		},
+		{
+			name: "write after the use in the loop of the declaration",
+			src: `package foo
+
+func F(a int, xs []int) int {
+	s := 0
+	for range xs {
+		/*start*/x := a/*end*/
+		s += x
+		a = 5
+	}
+	return s
+}
+`,
+			want: "s += a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, ok := testRefactoring(t, tt.src).inlineVariable()
+			if ok != (tt.want != "") {
+				t.Fatalf("inlined = %v, want %v\n%s", ok, tt.want != "", src)
+			}
+			if !ok {
+				return
+			}
+			if got := formatted(t, src); !strings.Contains(got, tt.want) {
+				t.Errorf("missing %q in:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInlineCall(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // line of the result, refused if empty
+	}{
+		{
+			name: "expression",
+			src: `package foo
+
+func double(n int) int { return n * 2 }
+
+func F(a int) int {
+	return /*start*/double/*end*/(a + 1)
+}
+`,
+			want: "return (a + 1) * 2",
+		},
+		{
+			name: "field of parameter written",
+			src: `package foo
+
+type S struct{ n int }
+
+func reset(s S) { s.n = 0 }
+
+func F(s S) int {
+	/*start*/reset/*end*/(s)
+	return s.n
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, ok := testRefactoring(t, tt.src).inlineCall()
+			if ok != (tt.want != "") {
+				t.Fatalf("inlined = %v, want %v\n%s", ok, tt.want != "", src)
+			}
+			if !ok {
+				return
+			}
+			if got := formatted(t, src); !strings.Contains(got, tt.want) {
+				t.Errorf("missing %q in:\n%s", tt.want, got)
+			}
+		})
+	}
+}
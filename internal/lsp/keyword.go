@@ -0,0 +1,349 @@
+package lsp
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// keywordContext is the syntactic context of the position being
+// completed, deciding which keywords are valid.
+type keywordContext int
+
+const (
+	keywordExpr     keywordContext = iota // e.g. `x := |`
+	keywordStmt                           // start of a statement
+	keywordTopLevel                       // start of a top-level declaration
+)
+
+var (
+	topLevelKeywords = []string{"const", "func", "import", "type", "var"}
+	stmtKeywords     = []string{
+		"const", "defer", "for", "go", "goto", "if", "return",
+		"select", "switch", "type", "var",
+	}
+	exprKeywords = []string{"chan", "func", "interface", "map", "struct"}
+)
+
+// keywordContextOf returns the keyword context of the position
+// following the node at paths[0].
+func keywordContextOf(paths []ast.Node) keywordContext {
+	if !insideFunc(paths) {
+		if declStart(paths) {
+			return keywordTopLevel
+		}
+		// e.g. `var x = |`
+		return keywordExpr
+	}
+	for i, n := range paths {
+		switch n.(type) {
+		case *ast.Ident:
+			continue
+		case *ast.ExprStmt:
+			// the identifier is the whole statement
+			if i == 1 {
+				return keywordStmt
+			}
+			return keywordExpr
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+			return keywordStmt
+		default:
+			return keywordExpr
+		}
+	}
+	return keywordExpr
+}
+
+// declStart reports whether paths is at the start of a top-level
+// declaration, i.e. not in a declaration yet.
+func declStart(paths []ast.Node) bool {
+	for _, n := range paths {
+		switch n.(type) {
+		case *ast.Ident:
+			continue
+		case *ast.File, *ast.BadDecl:
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// insideFunc reports whether paths goes through a function body.
+func insideFunc(paths []ast.Node) bool {
+	for _, n := range paths {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			return n.Body != nil
+		case *ast.FuncLit:
+			return true
+		}
+	}
+	return false
+}
+
+// keywordCandidates returns the keywords valid in kctx, along with the
+// statement templates when snippets are supported.
+func (c *completionContext) keywordCandidates(kctx keywordContext, f *ast.File, paths []ast.Node, pos token.Pos, tcr *TypeCheckResult) []candidate {
+	var keywords []string
+	switch kctx {
+	case keywordTopLevel:
+		for _, k := range topLevelKeywords {
+			if k == "import" && !importsAllowed(f, pos) {
+				continue
+			}
+			keywords = append(keywords, k)
+		}
+	case keywordStmt:
+		keywords = append(keywords, stmtKeywords...)
+		keywords = append(keywords, branchKeywords(paths)...)
+		keywords = append(keywords, exprKeywords...)
+	default:
+		keywords = exprKeywords
+	}
+
+	cands := make([]candidate, 0, len(keywords))
+	for _, k := range keywords {
+		cands = append(cands, candidate{
+			item: protocol.CompletionItem{
+				Label: k,
+				Kind:  protocol.CompletionItemKindKeyword,
+			},
+		})
+	}
+	if kctx == keywordStmt && c.snippets {
+		cands = append(cands, c.statementTemplates(paths, pos, tcr)...)
+	}
+	return cands
+}
+
+// importsAllowed reports whether an import declaration can be added at
+// pos, i.e. before any other declaration.
+func importsAllowed(f *ast.File, pos token.Pos) bool {
+	for _, d := range f.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			continue
+		}
+		return pos <= d.Pos()
+	}
+	return true
+}
+
+// branchKeywords returns the keywords only valid inside loops,
+// switches, selects or case clauses enclosing paths.
+func branchKeywords(paths []ast.Node) []string {
+	var loop, breakable, fallthroughable, clause bool
+outer:
+	for i, n := range paths {
+		switch n.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			loop, breakable = true, true
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			breakable = true
+		case *ast.CaseClause:
+			// fallthrough is not permitted in type switches
+			if i+2 < len(paths) {
+				if _, ok := paths[i+2].(*ast.SwitchStmt); ok {
+					fallthroughable = true
+				}
+			}
+			clause = true
+		case *ast.CommClause:
+			clause = true
+		case *ast.FuncDecl, *ast.FuncLit:
+			break outer
+		}
+	}
+	var res []string
+	if breakable {
+		res = append(res, "break")
+	}
+	if loop {
+		res = append(res, "continue")
+	}
+	if fallthroughable {
+		res = append(res, "fallthrough")
+	}
+	if clause {
+		res = append(res, "case", "default")
+	}
+	return res
+}
+
+// statementTemplates returns snippets of common statements.
+func (c *completionContext) statementTemplates(paths []ast.Node, pos token.Pos, tcr *TypeCheckResult) []candidate {
+	cands := []candidate{
+		templateCandidate("for range", "for ${1:i}, ${2:v} := range ${3:s} {\n\t$0\n}"),
+		templateCandidate("switch case", "switch ${1:x} {\ncase ${2:value}:\n\t$0\n}"),
+	}
+
+	// `if err != nil` is only offered if `err` is in scope.
+	if tcr.pkg == nil {
+		return cands
+	}
+	scope := tcr.pkg.Scope().Innermost(pos)
+	if scope == nil {
+		return cands
+	}
+	_, obj := scope.LookupParent("err", pos)
+	if obj == nil || !types.Implements(obj.Type(), errorInterface) {
+		return cands
+	}
+	ret := "return err"
+	if sig := enclosingSignature(paths, tcr.info); sig != nil {
+		ret = returnErr(sig, c.from)
+	}
+	cands = append(cands, templateCandidate("if err != nil", "if err != nil {\n\t"+ret+"\n}"))
+	return cands
+}
+
+// returnErr returns the statement returning err from a function of
+// signature sig, using zero values for the other results.
+func returnErr(sig *types.Signature, from *types.Package) string {
+	results := sig.Results()
+	if results.Len() == 0 {
+		return "${1:panic(err)}"
+	}
+	vals := make([]string, results.Len())
+	for i := 0; i < results.Len(); i++ {
+		t := results.At(i).Type()
+		if i == results.Len()-1 && types.Identical(t, errorType) {
+			vals[i] = "err"
+			continue
+		}
+		vals[i] = fmt.Sprintf("${%d:%s}", i+1, snippetEscape(zeroValue(t, types.RelativeTo(from))))
+	}
+	return "return " + strings.Join(vals, ", ")
+}
+
+var (
+	errorType      = types.Universe.Lookup("error").Type()
+	errorInterface = errorType.Underlying().(*types.Interface)
+)
+
+func templateCandidate(label, snippet string) candidate {
+	return candidate{
+		item: protocol.CompletionItem{
+			Label:            label,
+			Kind:             protocol.CompletionItemKindSnippet,
+			InsertText:       snippet,
+			InsertTextFormat: protocol.InsertTextFormatSnippet,
+		},
+	}
+}
+
+// postfixCandidates returns the postfix completions of the expression
+// sel.X, e.g. `x.print!` replaced by `println(x)`. They are only offered
+// for selectors in statement position and when snippets are supported.
+func (c *completionContext) postfixCandidates(sel *ast.SelectorExpr, paths []ast.Node, pos token.Pos, tcr *TypeCheckResult) []candidate {
+	if !c.snippets || !isStmtSelector(sel, paths) {
+		return nil
+	}
+	t := tcr.info.TypeOf(sel.X)
+	if t == nil {
+		return nil
+	}
+
+	x := types.ExprString(sel.X)
+	start := tcr.fset.Position(sel.X.Pos())
+	end := tcr.fset.Position(pos)
+	rng := protocol.Range{
+		Start: protocol.Position{Line: uint32(start.Line - 1), Character: uint32(start.Column - 1)},
+		End:   protocol.Position{Line: uint32(end.Line - 1), Character: uint32(end.Column - 1)},
+	}
+	postfix := func(label, detail, snippet string) candidate {
+		return candidate{
+			item: protocol.CompletionItem{
+				Label:            label,
+				Kind:             protocol.CompletionItemKindSnippet,
+				Detail:           detail,
+				FilterText:       x + "." + label,
+				InsertTextFormat: protocol.InsertTextFormatSnippet,
+				TextEdit: &protocol.TextEdit{
+					Range:   rng,
+					NewText: snippet,
+				},
+			},
+		}
+	}
+
+	x = snippetEscape(x)
+	cands := []candidate{
+		postfix("print!", "println("+x+")", "println("+x+")$0"),
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Slice, *types.Array, *types.Pointer:
+		if p, ok := u.(*types.Pointer); ok {
+			if _, ok := p.Elem().Underlying().(*types.Array); !ok {
+				break
+			}
+		}
+		cands = append(cands, postfix("range!", "for i, v := range "+x,
+			"for ${1:i}, ${2:v} := range "+x+" {\n\t$0\n}"))
+	case *types.Map:
+		cands = append(cands, postfix("range!", "for k, v := range "+x,
+			"for ${1:k}, ${2:v} := range "+x+" {\n\t$0\n}"))
+	case *types.Basic:
+		if u.Info()&types.IsString != 0 {
+			cands = append(cands, postfix("range!", "for i, r := range "+x,
+				"for ${1:i}, ${2:r} := range "+x+" {\n\t$0\n}"))
+		}
+	case *types.Chan:
+		cands = append(cands, postfix("range!", "for v := range "+x,
+			"for ${1:v} := range "+x+" {\n\t$0\n}"))
+	}
+	if types.Implements(t, errorInterface) {
+		cands = append(cands, postfix("ifnil!", "if "+x+" != nil",
+			"if "+x+" != nil {\n\t$0\n}"))
+	}
+	return cands
+}
+
+// isStmtSelector reports whether sel is typed at the start of a
+// statement. Note that `x.` followed by a newline is parsed along with
+// the next line, e.g. as the left side of an assignment.
+func isStmtSelector(sel *ast.SelectorExpr, paths []ast.Node) bool {
+	for i, n := range paths {
+		if n != sel {
+			continue
+		}
+		if i+1 >= len(paths) {
+			return false
+		}
+		switch parent := paths[i+1].(type) {
+		case *ast.ExprStmt:
+			return true
+		case *ast.AssignStmt:
+			return len(parent.Lhs) > 0 && parent.Lhs[0] == sel
+		}
+		return false
+	}
+	return false
+}
+
+// zeroValue returns the zero value of t, as Go source, with packages
+// named by qf.
+func zeroValue(t types.Type, qf types.Qualifier) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return "false"
+		case u.Info()&types.IsNumeric != 0:
+			return "0"
+		case u.Info()&types.IsString != 0:
+			return `""`
+		}
+		return "nil"
+	case *types.Struct, *types.Array:
+		return types.TypeString(t, qf) + "{}"
+	case *types.TypeParam:
+		return "*new(" + types.TypeString(t, qf) + ")"
+	}
+	return "nil"
+}
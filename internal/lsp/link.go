@@ -0,0 +1,128 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// gnoURLRe matches gno.land package paths in comments and strings. Paths
+// prefixed with a scheme are left to the client.
+var gnoURLRe = regexp.MustCompile(`(?:[a-z]+://)?gno\.land/[pr]/[A-Za-z0-9_./-]*[A-Za-z0-9_]`)
+
+// defaultGnowebURL is the gnoweb instance gno.land paths are linked to,
+// when no `gnowebURL` is set.
+const defaultGnowebURL = "https://gno.land"
+
+func (s *server) DocumentLink(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.DocumentLinkParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	file, ok := s.snapshot.Get(params.TextDocument.URI.Filename())
+	if !ok {
+		return reply(ctx, nil, errors.New("snapshot not found"))
+	}
+	pgf, err := file.ParseGno2(ctx)
+	if err != nil {
+		return reply(ctx, nil, nil)
+	}
+
+	links := []protocol.DocumentLink{}
+	add := func(pos, end token.Pos, target, tooltip string) {
+		links = append(links, protocol.DocumentLink{
+			Range: protocol.Range{
+				Start: positionOf(pgf.Fset, pos),
+				End:   positionOf(pgf.Fset, end),
+			},
+			Target:  protocol.DocumentURI(target),
+			Tooltip: tooltip,
+		})
+	}
+	// addURLs links the gno.land paths found in text, starting at pos.
+	addURLs := func(pos token.Pos, text string) {
+		for _, m := range gnoURLRe.FindAllStringIndex(text, -1) {
+			path := text[m[0]:m[1]]
+			if strings.Contains(path, "://") {
+				continue
+			}
+			add(pos+token.Pos(m[0]), pos+token.Pos(m[1]), s.gnowebURL(path), "")
+		}
+	}
+
+	imports := map[*ast.BasicLit]bool{}
+	for _, spec := range pgf.File.Imports {
+		imports[spec.Path] = true
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		target, tooltip, ok := s.importTarget(path)
+		if !ok {
+			continue
+		}
+		// Exclude the quotes
+		add(spec.Path.Pos()+1, spec.Path.End()-1, target, tooltip)
+	}
+	ast.Inspect(pgf.File, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING && !imports[lit] {
+			addURLs(lit.Pos(), lit.Value)
+		}
+		return true
+	})
+	for _, cg := range pgf.File.Comments {
+		for _, c := range cg.List {
+			addURLs(c.Pos(), c.Text)
+		}
+	}
+	return reply(ctx, links, nil)
+}
+
+// importTarget returns the link target of the import path: the gnoweb
+// page of the package if a `gnowebURL` is set, its local directory
+// otherwise.
+func (s *server) importTarget(path string) (string, string, bool) {
+	if s.settings.GnowebURL != "" && strings.HasPrefix(path, "gno.land/") {
+		return s.gnowebURL(path), "Open in gnoweb", true
+	}
+	dir, ok := s.packageDir(path)
+	if !ok {
+		return "", "", false
+	}
+	return string(getURI(dir)), "Open package directory", true
+}
+
+// gnowebURL returns the URL of the gno.land path on the configured
+// gnoweb instance.
+func (s *server) gnowebURL(path string) string {
+	base := s.settings.GnowebURL
+	if base == "" {
+		base = defaultGnowebURL
+	}
+	return strings.TrimSuffix(base, "/") + strings.TrimPrefix(path, "gno.land")
+}
+
+// packageDir returns the directory of the package importPath, looked up
+// in the Cache then in the CompletionStore.
+func (s *server) packageDir(importPath string) (string, bool) {
+	for _, pkg := range s.cache.pkgs.Items() {
+		if pkg.ImportPath == importPath {
+			return pkg.Dir, true
+		}
+	}
+	for _, pkg := range s.completionStore.Load().pkgs {
+		if s.storeImportPath(pkg) == importPath {
+			return pkg.Dir, true
+		}
+	}
+	return "", false
+}
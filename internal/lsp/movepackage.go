@@ -0,0 +1,375 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// movePackageArgs are the arguments of `gnopls.movePackage`.
+type movePackageArgs struct {
+	// URI is a file of the package to move.
+	URI protocol.DocumentURI `json:"uri"`
+	// NewPath is the new import path of the package.
+	NewPath string `json:"newPath"`
+	// NewDir is the new directory of the package. If empty, it is
+	// derived from NewPath when the directory ends with the import path,
+	// as in `examples`; the package isn't moved otherwise.
+	NewDir string `json:"newDir,omitempty"`
+}
+
+// cmdMovePackage changes the import path of a package: it updates its
+// gno.mod, its package clause, the imports and the gno.mod of the
+// packages of the workspace and of the Cache, and moves its directory. The edit is applied,
+// and returned.
+func cmdMovePackage(ctx context.Context, s *server, args movePackageArgs) (any, error) {
+	edit, err := s.movePackage(args)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := s.applyDocumentChanges(context.WithoutCancel(ctx), "Move package", *edit); err != nil {
+			s.showMessage(ctx, protocol.MessageTypeError, err.Error())
+		}
+	}()
+	return edit, nil
+}
+
+// movePackage returns the edit of cmdMovePackage.
+func (s *server) movePackage(args movePackageArgs) (*workspaceEdit, error) {
+	dir := filepath.Dir(args.URI.Filename())
+	pkg, ok := s.cache.pkgs.Get(dir)
+	if !ok || pkg.ImportPath == "" {
+		return nil, fmt.Errorf("package of %s not found", dir)
+	}
+	oldPath, newPath := pkg.ImportPath, strings.TrimSuffix(args.NewPath, "/")
+	if newPath == "" || newPath == oldPath {
+		return nil, errors.New("invalid new path")
+	}
+
+	// Keep custom package names
+	oldName, newName := pkg.Name, pkg.Name
+	if oldName == path.Base(oldPath) {
+		newName = path.Base(newPath)
+	}
+	if !token.IsIdentifier(newName) {
+		return nil, fmt.Errorf("invalid package name %q", newName)
+	}
+
+	newDir := args.NewDir
+	if newDir == "" {
+		if prefix, ok := strings.CutSuffix(filepath.ToSlash(dir), "/"+oldPath); ok {
+			newDir = filepath.FromSlash(prefix + "/" + newPath)
+		}
+	}
+	if newDir != "" && newDir != dir {
+		if _, err := os.Stat(newDir); err == nil {
+			return nil, fmt.Errorf("%s already exists", newDir)
+		}
+		if !s.resourceOperationSupport(protocol.RenameResourceOperation) {
+			return nil, errors.New("the client cannot rename directories")
+		}
+	}
+
+	// The moved package first, then the other packages of the workspace
+	// and of the Cache
+	others := map[string]bool{}
+	for d := range s.cache.pkgs.Items() {
+		others[d] = true
+	}
+	wsDirs, err := s.workspacePackageDirs()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range wsDirs {
+		others[d] = true
+	}
+	delete(others, dir)
+	dirs := []string{dir}
+	for d := range others {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs[1:])
+
+	mv := &packageMove{
+		oldPath: oldPath,
+		newPath: newPath,
+		oldName: oldName,
+		newName: newName,
+	}
+	tc, _ := NewTypeCheck()
+	tc.cfg.Importer = tc // set typeCheck importer
+	edit := &workspaceEdit{DocumentChanges: []interface{}{}}
+	for _, d := range dirs {
+		changes, err := s.dirEdits(mv, d, d == dir, tc)
+		if err != nil {
+			return nil, err
+		}
+		edit.DocumentChanges = append(edit.DocumentChanges, changes...)
+	}
+
+	if newDir != "" && newDir != dir {
+		edit.DocumentChanges = append(edit.DocumentChanges, protocol.RenameFile{
+			Kind:   protocol.RenameResourceOperation,
+			OldURI: getURI(dir),
+			NewURI: getURI(newDir),
+		})
+	}
+	return edit, nil
+}
+
+// dirEdits returns the edits of the gno.mod and the gno files of dir,
+// the directory of the moved package if moved is set. The files
+// referring to the moved package are type-checked with tc, by package
+// (filetests are standalone packages), to find its qualified
+// identifiers.
+func (s *server) dirEdits(mv *packageMove, dir string, moved bool, tc *TypeCheck) ([]interface{}, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	changes := []interface{}{}
+	add := func(filename string, edits []protocol.TextEdit) {
+		if len(edits) == 0 {
+			return
+		}
+		changes = append(changes, protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: getURI(filename)},
+			},
+			Edits: edits,
+		})
+	}
+
+	packages := map[string][]*FileInfo{}
+	var keys []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || (name != "gno.mod" && !strings.HasSuffix(name, ".gno")) {
+			continue
+		}
+		filename := filepath.Join(dir, name)
+		src, err := s.snapshot.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if name == "gno.mod" {
+			add(filename, mv.gnoModEdits(src, moved))
+			continue
+		}
+		key := packageName(src)
+		if isFiletest(name) {
+			key = name
+		}
+		if packages[key] == nil {
+			keys = append(keys, key)
+		}
+		packages[key] = append(packages[key], &FileInfo{Name: name, Body: string(src)})
+	}
+
+	for _, key := range keys {
+		files := packages[key]
+		refers := slices.ContainsFunc(files, func(f *FileInfo) bool {
+			return strings.Contains(f.Body, mv.oldPath)
+		})
+		switch {
+		case refers:
+			res := typeCheckWith(&PackageInfo{Dir: dir, Files: files}, tc.cache)
+			for _, f := range res.files {
+				name := res.fset.File(f.Pos()).Name()
+				add(filepath.Join(dir, name), mv.fileEdits(res.fset, f, res.info, moved))
+			}
+		case moved:
+			for _, file := range files {
+				fset := token.NewFileSet()
+				f, err := parser.ParseFile(fset, file.Name, file.Body, parser.ParseComments)
+				if err != nil {
+					continue
+				}
+				add(filepath.Join(dir, file.Name), mv.fileEdits(fset, f, nil, moved))
+			}
+		}
+	}
+	return changes, nil
+}
+
+// workspacePackageDirs returns the directories of the workspace holding
+// gno files or a gno.mod, hidden directories excluded.
+func (s *server) workspacePackageDirs() ([]string, error) {
+	seen := map[string]bool{}
+	var dirs []string
+	for _, root := range s.workspaceDirs {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				return nil // unreadable, skip
+			}
+			name := entry.Name()
+			if entry.IsDir() {
+				if path != root && strings.HasPrefix(name, ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if name != "gno.mod" && !strings.HasSuffix(name, ".gno") {
+				return nil
+			}
+			if d := filepath.Dir(path); !seen[d] {
+				seen[d] = true
+				dirs = append(dirs, d)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// packageMove is the change of the import path, and maybe of the name,
+// of a package.
+type packageMove struct {
+	oldPath, newPath string
+	oldName, newName string
+}
+
+// gnoModEdits returns the edits of a gno.mod: its module line if moved
+// is set, its require lines otherwise.
+func (mv *packageMove) gnoModEdits(src []byte, moved bool) []protocol.TextEdit {
+	var edits []protocol.TextEdit
+	inRequire := false
+	for i, line := range strings.Split(string(src), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var path string
+		switch {
+		case fields[0] == "module" && len(fields) > 1 && moved:
+			path = fields[1]
+		case fields[0] == "require" && len(fields) > 1 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require" && len(fields) > 1:
+			path = fields[1]
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire:
+			path = fields[0]
+		}
+		if path == "" || strings.Trim(path, `"`) != mv.oldPath {
+			continue
+		}
+		start := strings.Index(line, path)
+		newPath := mv.newPath
+		if strings.HasPrefix(path, `"`) {
+			newPath = strconv.Quote(newPath)
+		}
+		edits = append(edits, protocol.TextEdit{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: uint32(i), Character: uint32(start)},
+				End:   protocol.Position{Line: uint32(i), Character: uint32(start + len(path))},
+			},
+			NewText: newPath,
+		})
+	}
+	return edits
+}
+
+// fileEdits returns the edits of the gno file f: its package clause and
+// its `PKGPATH` directive if moved is set, and its imports of the
+// package along with the identifiers qualified by them. info is needed
+// for the latter, it may be nil if f doesn't import the package.
+func (mv *packageMove) fileEdits(fset *token.FileSet, f *ast.File, info *types.Info, moved bool) []protocol.TextEdit {
+	var edits []protocol.TextEdit
+	add := func(pos, end token.Pos, text string) {
+		edits = append(edits, protocol.TextEdit{
+			Range: protocol.Range{
+				Start: positionOf(fset, pos),
+				End:   positionOf(fset, end),
+			},
+			NewText: text,
+		})
+	}
+
+	if moved && mv.newName != mv.oldName {
+		switch f.Name.Name {
+		case mv.oldName:
+			add(f.Name.Pos(), f.Name.End(), mv.newName)
+		case mv.oldName + "_test":
+			add(f.Name.Pos(), f.Name.End(), mv.newName+"_test")
+		}
+	}
+	if moved && isFiletest(fset.Position(f.Pos()).Filename) {
+		for _, d := range parseDirectives(f) {
+			if d.Name != "PKGPATH" || d.Value != mv.oldPath {
+				continue
+			}
+			start := d.Comment.Pos() + token.Pos(strings.Index(d.Comment.Text, mv.oldPath))
+			add(start, start+token.Pos(len(mv.oldPath)), mv.newPath)
+		}
+	}
+
+	for _, spec := range f.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err != nil || path != mv.oldPath {
+			continue
+		}
+		newImport := strconv.Quote(mv.newPath)
+		if pn, ok := info.Implicits[spec].(*types.PkgName); ok && mv.newName != mv.oldName {
+			// Imported without a name: rename the qualifiers, or keep
+			// the old name if the new one is taken.
+			if ids, ok := mv.qualifiers(f, info, pn); ok {
+				for _, id := range ids {
+					add(id.Pos(), id.End(), mv.newName)
+				}
+			} else {
+				newImport = mv.oldName + " " + newImport
+			}
+		}
+		add(spec.Path.Pos(), spec.Path.End(), newImport)
+	}
+	return edits
+}
+
+// qualifiers returns the identifiers of f referring to the package name
+// pn, and whether they can be renamed to the new name of the package:
+// it is declared neither in the file nor in the package, nor where
+// they are.
+func (mv *packageMove) qualifiers(f *ast.File, info *types.Info, pn *types.PkgName) ([]*ast.Ident, bool) {
+	fileScope := pn.Parent()
+	if fileScope.Lookup(mv.newName) != nil || fileScope.Parent().Lookup(mv.newName) != nil {
+		return nil, false
+	}
+	var ids []*ast.Ident
+	free := true
+	ast.Inspect(f, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || info.Uses[id] != pn {
+			return true
+		}
+		if scope := fileScope.Innermost(id.Pos()); scope != nil {
+			if _, obj := scope.LookupParent(mv.newName, id.Pos()); obj != nil {
+				free = false
+			}
+		}
+		ids = append(ids, id)
+		return true
+	})
+	return ids, free
+}
@@ -0,0 +1,137 @@
+package lsp
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestMovePackage(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/p/demo/bar/gno.mod": "module gno.land/p/demo/bar\n",
+		"gno.land/p/demo/bar/bar.gno": "package /*pkg*/bar\n\nfunc Hello() string { return \"hello\" }\n",
+		// Not opened, so not in the Cache
+		"gno.land/r/demo/foo/gno.mod": "module gno.land/r/demo/foo\n\nrequire gno.land/p/demo/bar v0.0.0-latest\n",
+		"gno.land/r/demo/foo/foo.gno": "package foo\n\nimport \"gno.land/p/demo/bar\"\n\nvar s = bar.Hello()\n",
+	})
+	examples := filepath.Join(s.env.GNOROOT, "examples")
+	s.workspaceDirs = []string{examples}
+	args := movePackageArgs{URI: locs["pkg"].URI, NewPath: "gno.land/p/demo/baz"}
+
+	if _, err := s.movePackage(args); err == nil {
+		t.Error("moved the directory without client support")
+	}
+
+	s.capabilities.Workspace = &protocol.WorkspaceClientCapabilities{
+		WorkspaceEdit: &protocol.WorkspaceClientCapabilitiesWorkspaceEdit{
+			ResourceOperations: []string{string(protocol.RenameResourceOperation)},
+		},
+	}
+	edit, err := s.movePackage(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := map[string]bool{}
+	renamed := false
+	for _, change := range edit.DocumentChanges {
+		switch change := change.(type) {
+		case protocol.TextDocumentEdit:
+			rel, _ := filepath.Rel(examples, change.TextDocument.URI.Filename())
+			edited[filepath.ToSlash(rel)] = true
+		case protocol.RenameFile:
+			renamed = change.NewURI == getURI(filepath.Join(examples, "gno.land/p/demo/baz"))
+		}
+	}
+	for _, name := range []string{
+		"gno.land/p/demo/bar/gno.mod",
+		"gno.land/p/demo/bar/bar.gno",
+		"gno.land/r/demo/foo/gno.mod",
+		"gno.land/r/demo/foo/foo.gno",
+	} {
+		if !edited[name] {
+			t.Errorf("%s not edited", name)
+		}
+	}
+	if !renamed {
+		t.Error("directory not renamed")
+	}
+}
+
+func TestMovePackageQualifiers(t *testing.T) {
+	const imp = "package foo\n\nimport \"gno.land/p/demo/bar\"\n\n"
+	tests := []struct {
+		name  string
+		src   string
+		other string // another file of the package
+		want  string
+	}{
+		{
+			name: "renamed",
+			src:  imp + "var s = bar.Hello()\n",
+			want: "package foo\n\nimport \"gno.land/p/demo/baz\"\n\nvar s = baz.Hello()\n",
+		},
+		{
+			name:  "new name declared in the package",
+			src:   imp + "var s = bar.Hello()\n",
+			other: "package foo\n\nvar baz = 1\n",
+			want:  "package foo\n\nimport bar \"gno.land/p/demo/baz\"\n\nvar s = bar.Hello()\n",
+		},
+		{
+			name: "new name declared at a use",
+			src:  imp + "func F() string {\n\tbaz := \"\"\n\treturn baz + bar.Hello()\n}\n",
+			want: "package foo\n\nimport bar \"gno.land/p/demo/baz\"\n\nfunc F() string {\n\tbaz := \"\"\n\treturn baz + bar.Hello()\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{
+				"gno.land/p/demo/bar/gno.mod": "module gno.land/p/demo/bar\n",
+				"gno.land/p/demo/bar/bar.gno": "package bar\n\nfunc Hello() string { return \"hello\" }\n",
+				"gno.land/r/demo/foo/foo.gno": tt.src,
+			}
+			if tt.other != "" {
+				files["gno.land/r/demo/foo/other.gno"] = tt.other
+			}
+			s, _ := testServer(t, files)
+			dir := filepath.Join(s.env.GNOROOT, "examples", "gno.land", "r", "demo", "foo")
+			mv := &packageMove{oldPath: "gno.land/p/demo/bar", newPath: "gno.land/p/demo/baz", oldName: "bar", newName: "baz"}
+			tc, _ := NewTypeCheck()
+			tc.cfg.Importer = tc
+			changes, err := s.dirEdits(mv, dir, false, tc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := tt.src
+			for _, change := range changes {
+				change := change.(protocol.TextDocumentEdit)
+				if filepath.Base(change.TextDocument.URI.Filename()) == "foo.gno" {
+					got = applyEdits(got, change.Edits)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// applyEdits returns src with the non-overlapping edits applied.
+func applyEdits(src string, edits []protocol.TextEdit) string {
+	offset := func(p protocol.Position) int {
+		off := 0
+		for i := uint32(0); i < p.Line; i++ {
+			off += strings.IndexByte(src[off:], '\n') + 1
+		}
+		return off + int(p.Character)
+	}
+	edits = slices.Clone(edits)
+	sort.Slice(edits, func(i, j int) bool { return offset(edits[i].Range.Start) > offset(edits[j].Range.Start) })
+	for _, e := range edits {
+		src = src[:offset(e.Range.Start)] + e.NewText + src[offset(e.Range.End):]
+	}
+	return src
+}
@@ -0,0 +1,73 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"go.lsp.dev/protocol"
+)
+
+var progressID atomic.Int32
+
+// workDone reports the progress of a long running task using `$/progress`.
+// A workDone with a nil token is a no-op.
+type workDone struct {
+	s     *server
+	token *protocol.ProgressToken
+}
+
+// beginProgress starts reporting progress on token. If token is nil, a
+// new one is created with `window/workDoneProgress/create`, if the client
+// supports it.
+// Note: it must not be called from the request handler itself, as it
+// waits for the client to answer.
+func (s *server) beginProgress(ctx context.Context, token *protocol.ProgressToken, title string) *workDone {
+	if token == nil {
+		if w := s.capabilities.Window; w == nil || !w.WorkDoneProgress {
+			return &workDone{s: s}
+		}
+		token = protocol.NewProgressToken(fmt.Sprintf("gnopls-%d", progressID.Add(1)))
+		_, err := s.conn.Call(ctx, protocol.MethodWorkDoneProgressCreate, protocol.WorkDoneProgressCreateParams{
+			Token: *token,
+		}, nil)
+		if err != nil {
+			slog.Error("progress", "err", err)
+			return &workDone{s: s}
+		}
+	}
+	wd := &workDone{s: s, token: token}
+	wd.notify(ctx, &protocol.WorkDoneProgressBegin{
+		Kind:  protocol.WorkDoneProgressKindBegin,
+		Title: title,
+	})
+	return wd
+}
+
+func (wd *workDone) report(ctx context.Context, msg string) {
+	wd.notify(ctx, &protocol.WorkDoneProgressReport{
+		Kind:    protocol.WorkDoneProgressKindReport,
+		Message: msg,
+	})
+}
+
+func (wd *workDone) end(ctx context.Context, msg string) {
+	wd.notify(ctx, &protocol.WorkDoneProgressEnd{
+		Kind:    protocol.WorkDoneProgressKindEnd,
+		Message: msg,
+	})
+}
+
+func (wd *workDone) notify(ctx context.Context, value any) {
+	if wd.token == nil {
+		return
+	}
+	err := wd.s.conn.Notify(ctx, protocol.MethodProgress, &protocol.ProgressParams{
+		Token: *wd.token,
+		Value: value,
+	})
+	if err != nil {
+		slog.Error("progress", "err", err)
+	}
+}
@@ -0,0 +1,170 @@
+package lsp
+
+import "go.lsp.dev/protocol"
+
+// LSP 3.17 types missing from go.lsp.dev/protocol.
+
+// serverCapabilities extends protocol.ServerCapabilities with the
+// capabilities of LSP 3.17.
+type serverCapabilities struct {
+	protocol.ServerCapabilities
+
+	TypeHierarchyProvider bool               `json:"typeHierarchyProvider,omitempty"`
+	InlayHintProvider     bool               `json:"inlayHintProvider,omitempty"`
+	DiagnosticProvider    *diagnosticOptions `json:"diagnosticProvider,omitempty"`
+}
+
+// semanticTokensOptions is protocol.SemanticTokensOptions, which misses
+// the legend and the supported requests.
+type semanticTokensOptions struct {
+	Legend protocol.SemanticTokensLegend `json:"legend"`
+	Range  bool                          `json:"range,omitempty"`
+	Full   *semanticTokensFullOptions    `json:"full,omitempty"`
+}
+
+type semanticTokensFullOptions struct {
+	Delta bool `json:"delta,omitempty"`
+}
+
+// initializeResult is protocol.InitializeResult using serverCapabilities.
+type initializeResult struct {
+	Capabilities serverCapabilities   `json:"capabilities"`
+	ServerInfo   *protocol.ServerInfo `json:"serverInfo,omitempty"`
+}
+
+type typeHierarchyPrepareParams struct {
+	protocol.TextDocumentPositionParams
+	protocol.WorkDoneProgressParams
+}
+
+type typeHierarchyItem struct {
+	Name           string               `json:"name"`
+	Kind           protocol.SymbolKind  `json:"kind"`
+	Tags           []protocol.SymbolTag `json:"tags,omitempty"`
+	Detail         string               `json:"detail,omitempty"`
+	URI            protocol.DocumentURI `json:"uri"`
+	Range          protocol.Range       `json:"range"`
+	SelectionRange protocol.Range       `json:"selectionRange"`
+	Data           interface{}          `json:"data,omitempty"`
+}
+
+// typeHierarchyParams are the params of both `typeHierarchy/supertypes`
+// and `typeHierarchy/subtypes`.
+type typeHierarchyParams struct {
+	protocol.WorkDoneProgressParams
+	protocol.PartialResultParams
+
+	Item typeHierarchyItem `json:"item"`
+}
+
+type inlayHintParams struct {
+	protocol.WorkDoneProgressParams
+
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+	Range        protocol.Range                  `json:"range"`
+}
+
+type inlayHintKind uint32
+
+const (
+	inlayHintKindType      inlayHintKind = 1
+	inlayHintKindParameter inlayHintKind = 2
+)
+
+type inlayHint struct {
+	Position     protocol.Position `json:"position"`
+	Label        string            `json:"label"`
+	Kind         inlayHintKind     `json:"kind,omitempty"`
+	Tooltip      string            `json:"tooltip,omitempty"`
+	PaddingLeft  bool              `json:"paddingLeft,omitempty"`
+	PaddingRight bool              `json:"paddingRight,omitempty"`
+}
+
+// workspaceEdit is protocol.WorkspaceEdit with resource operations: its
+// document changes are protocol.TextDocumentEdit, protocol.CreateFile,
+// protocol.RenameFile or protocol.DeleteFile, applied in order.
+type workspaceEdit struct {
+	DocumentChanges []interface{} `json:"documentChanges"`
+}
+
+// applyWorkspaceEditParams is protocol.ApplyWorkspaceEditParams using
+// workspaceEdit.
+type applyWorkspaceEditParams struct {
+	Label string        `json:"label,omitempty"`
+	Edit  workspaceEdit `json:"edit"`
+}
+
+// diagnosticClientCapabilities are the pull diagnostics capabilities of
+// the client, missing from protocol.ClientCapabilities.
+type diagnosticClientCapabilities struct {
+	TextDocument struct {
+		Diagnostic *struct {
+			DynamicRegistration    bool `json:"dynamicRegistration,omitempty"`
+			RelatedDocumentSupport bool `json:"relatedDocumentSupport,omitempty"`
+		} `json:"diagnostic,omitempty"`
+	} `json:"textDocument"`
+	Workspace struct {
+		Diagnostics *struct {
+			RefreshSupport bool `json:"refreshSupport,omitempty"`
+		} `json:"diagnostics,omitempty"`
+	} `json:"workspace"`
+}
+
+// diagnosticOptions are the options of the pull diagnostics capability.
+type diagnosticOptions struct {
+	Identifier            string `json:"identifier,omitempty"`
+	InterFileDependencies bool   `json:"interFileDependencies"`
+	WorkspaceDiagnostics  bool   `json:"workspaceDiagnostics"`
+}
+
+type documentDiagnosticParams struct {
+	TextDocument     protocol.TextDocumentIdentifier `json:"textDocument"`
+	Identifier       string                          `json:"identifier,omitempty"`
+	PreviousResultID string                          `json:"previousResultId,omitempty"`
+}
+
+type documentDiagnosticReportKind string
+
+const (
+	fullDiagnosticReport      documentDiagnosticReportKind = "full"
+	unchangedDiagnosticReport documentDiagnosticReportKind = "unchanged"
+)
+
+type fullDocumentDiagnosticReport struct {
+	Kind     documentDiagnosticReportKind `json:"kind"`
+	ResultID string                       `json:"resultId,omitempty"`
+	Items    []protocol.Diagnostic        `json:"items"`
+}
+
+type unchangedDocumentDiagnosticReport struct {
+	Kind     documentDiagnosticReportKind `json:"kind"`
+	ResultID string                       `json:"resultId"`
+}
+
+type workspaceDiagnosticParams struct {
+	Identifier        string             `json:"identifier,omitempty"`
+	PreviousResultIDs []previousResultID `json:"previousResultIds"`
+}
+
+type previousResultID struct {
+	URI   protocol.DocumentURI `json:"uri"`
+	Value string               `json:"value"`
+}
+
+// workspaceDiagnosticReport items are workspaceFullDocumentDiagnosticReport
+// or workspaceUnchangedDocumentDiagnosticReport.
+type workspaceDiagnosticReport struct {
+	Items []interface{} `json:"items"`
+}
+
+type workspaceFullDocumentDiagnosticReport struct {
+	fullDocumentDiagnosticReport
+	URI     protocol.DocumentURI `json:"uri"`
+	Version *int32               `json:"version"`
+}
+
+type workspaceUnchangedDocumentDiagnosticReport struct {
+	unchangedDocumentDiagnosticReport
+	URI     protocol.DocumentURI `json:"uri"`
+	Version *int32               `json:"version"`
+}
@@ -0,0 +1,457 @@
+package lsp
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.lsp.dev/protocol"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// candidate is a completion item along with what is needed to rank it.
+type candidate struct {
+	item protocol.CompletionItem
+
+	// obj is the object completed, if known (nil for keywords and
+	// symbols of the CompletionStore).
+	obj types.Object
+
+	local bool // declared in the enclosing function
+	depth int  // 1 for deep candidates, e.g. `x.Field`
+
+	// call is set for functions, params contains the names of
+	// their parameters used for snippets.
+	call   bool
+	params []string
+
+	// data is set for items resolved by `completionItem/resolve`.
+	data *completionData
+
+	score float64
+}
+
+// completionContext contains what is known about the position
+// being completed.
+type completionContext struct {
+	prefix   string         // identifier typed before the cursor
+	expected types.Type     // type expected at the cursor, if any
+	from     *types.Package // package being completed
+	snippets bool           // client supports snippets
+	uri      protocol.DocumentURI
+}
+
+// Relevance factors, multiplied with the fuzzy match score.
+const (
+	scoreExactType      = 3.0
+	scoreAssignableType = 2.0
+	scoreResultType     = 1.5
+	scoreLocal          = 1.5
+	scorePackageLevel   = 1.2
+	scoreExported       = 1.1
+	scoreBuiltin        = 0.8
+	scoreKeyword        = 0.8
+	scoreDeep           = 0.5
+
+	// maxDeepCandidates limits the number of deep candidates,
+	// as big structs would flood the completion list.
+	maxDeepCandidates = 50
+)
+
+// rank filters out the candidates not matching the prefix, then sorts
+// the remaining ones by score. Sorting is kept by the client through
+// `SortText`.
+func (c *completionContext) rank(cands []candidate) []protocol.CompletionItem {
+	if c.expected != nil {
+		cands = append(cands, c.deepCandidates(cands)...)
+	}
+
+	matches := []candidate{}
+	for _, cand := range cands {
+		m := fuzzyScore(c.prefix, cand.item.Label)
+		if m == 0 {
+			continue
+		}
+		cand.score = m * c.relevance(cand)
+		matches = append(matches, cand)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].item.Label < matches[j].item.Label
+	})
+
+	items := make([]protocol.CompletionItem, len(matches))
+	for i, cand := range matches {
+		item := cand.item
+		item.SortText = fmt.Sprintf("%05d", i)
+		if item.FilterText == "" {
+			item.FilterText = item.Label
+		}
+		if c.snippets && cand.call {
+			item.InsertText = callSnippet(item.Label, cand)
+			item.InsertTextFormat = protocol.InsertTextFormatSnippet
+		}
+		if cand.data != nil {
+			// Sent on `completionItem/resolve`
+			data := *cand.data
+			data.URI = c.uri
+			item.Data = data
+			item.Detail = ""
+			item.Documentation = nil
+		}
+		items[i] = item
+	}
+	return items
+}
+
+// relevance returns the score factor of cand, regardless of the prefix.
+func (c *completionContext) relevance(cand candidate) float64 {
+	r := 1.0
+	switch cand.item.Kind {
+	case protocol.CompletionItemKindKeyword, protocol.CompletionItemKindSnippet:
+		r *= scoreKeyword
+	}
+	if cand.local {
+		r *= scoreLocal
+	}
+	if obj := cand.obj; obj != nil {
+		switch {
+		case obj.Pkg() == nil:
+			r *= scoreBuiltin
+		case c.from != nil && obj.Parent() == c.from.Scope():
+			r *= scorePackageLevel
+		}
+		if obj.Exported() {
+			r *= scoreExported
+		}
+		if c.expected != nil {
+			r *= matchType(obj.Type(), c.expected)
+		}
+	}
+	for i := 0; i < cand.depth; i++ {
+		r *= scoreDeep
+	}
+	return r
+}
+
+// matchType returns the score factor of a candidate of type t when
+// expected is expected at the cursor.
+func matchType(t, expected types.Type) float64 {
+	if t == nil {
+		return 1
+	}
+	if sig, ok := t.(*types.Signature); ok {
+		if sig.Results().Len() != 1 {
+			return 1
+		}
+		if m := matchType(sig.Results().At(0).Type(), expected); m > 1 {
+			return scoreResultType
+		}
+		return 1
+	}
+	switch {
+	case types.Identical(t, expected):
+		return scoreExactType
+	case types.AssignableTo(t, expected):
+		return scoreAssignableType
+	}
+	return 1
+}
+
+// deepCandidates returns the fields and methods without params, one
+// level down the variables of the current package, whose type matches
+// the expected type. e.g. `user.Name` when a string is expected.
+func (c *completionContext) deepCandidates(cands []candidate) []candidate {
+	res := []candidate{}
+	for _, cand := range cands {
+		v, ok := cand.obj.(*types.Var)
+		if !ok || v.IsField() || v.Pkg() != c.from || cand.depth > 0 {
+			continue
+		}
+		for _, f := range structFields(v.Type()) {
+			if !isAccessible(f, c.from) || matchType(f.Type(), c.expected) == 1 {
+				continue
+			}
+			item := objectItem(f, c.from)
+			item.Label = v.Name() + "." + f.Name()
+			item.InsertText = item.Label
+			res = append(res, candidate{item: item, obj: f, local: cand.local, depth: 1})
+		}
+		for _, sel := range typeutil.IntuitiveMethodSet(v.Type(), nil) {
+			m := sel.Obj().(*types.Func)
+			sig := m.Type().(*types.Signature)
+			if !isAccessible(m, c.from) || sig.Params().Len() > 0 || matchType(sig, c.expected) == 1 {
+				continue
+			}
+			item := objectItem(m, c.from)
+			item.Label = v.Name() + "." + m.Name()
+			item.InsertText = item.Label + "()"
+			res = append(res, candidate{item: item, obj: m, local: cand.local, depth: 1})
+		}
+		if len(res) >= maxDeepCandidates {
+			return res[:maxDeepCandidates]
+		}
+	}
+	return res
+}
+
+// fuzzyScore returns how well pattern matches name, in (0, 1], or 0 if
+// the characters of pattern don't appear in order in name. Matching is
+// case-insensitive, but matches at the start of name, at the start of
+// a word (e.g. `B` in `FooBar`), consecutive ones and the ones with
+// the same case score higher.
+func fuzzyScore(pattern, name string) float64 {
+	if pattern == "" {
+		return 1
+	}
+	p, n := []rune(pattern), []rune(name)
+	score, prev, j := 0.0, -2, 0
+	for i := 0; i < len(n) && j < len(p); i++ {
+		if unicode.ToLower(n[i]) != unicode.ToLower(p[j]) {
+			continue
+		}
+		s := 1.0
+		switch {
+		case i == 0:
+			s = 3
+		case i == prev+1 || isWordStart(n, i):
+			s = 2
+		}
+		if n[i] == p[j] {
+			s += 0.5
+		}
+		score += s
+		prev = i
+		j++
+	}
+	if j < len(p) {
+		return 0
+	}
+	best := 3.5 + 2.5*float64(len(p)-1)
+	// Prefer shorter names among equal matches.
+	return score / best * (0.9 + 0.1*float64(len(p))/float64(len(n)))
+}
+
+func isWordStart(name []rune, i int) bool {
+	prev := name[i-1]
+	return prev == '_' || prev == '.' || (unicode.IsUpper(name[i]) && unicode.IsLower(prev))
+}
+
+// identPrefix returns the part of the identifier ending at offset in src.
+func identPrefix(src []byte, offset int) string {
+	if offset > len(src) {
+		return ""
+	}
+	start := offset
+	for start > 0 {
+		r, size := utf8.DecodeLastRune(src[:start])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		start -= size
+	}
+	return string(src[start:offset])
+}
+
+// callSnippet returns the snippet calling the function of cand, with
+// a placeholder per parameter.
+func callSnippet(name string, cand candidate) string {
+	if _, ok := cand.obj.(*types.Builtin); ok {
+		return name + "($1)"
+	}
+	placeholders := make([]string, len(cand.params))
+	for i, p := range cand.params {
+		placeholders[i] = fmt.Sprintf("${%d:%s}", i+1, snippetEscape(p))
+	}
+	return name + "(" + strings.Join(placeholders, ", ") + ")"
+}
+
+// snippetEscape escapes the characters having a meaning in snippets.
+func snippetEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`).Replace(s)
+}
+
+// signatureParams returns the parameter names of sig, falling back
+// to their types for unnamed ones.
+func signatureParams(sig *types.Signature, from *types.Package) []string {
+	params := make([]string, sig.Params().Len())
+	for i := range params {
+		p := sig.Params().At(i)
+		params[i] = p.Name()
+		if params[i] == "" || params[i] == "_" {
+			params[i] = types.TypeString(p.Type(), types.RelativeTo(from))
+		}
+		if sig.Variadic() && i == len(params)-1 {
+			params[i] += "..."
+		}
+	}
+	return params
+}
+
+// expectedType returns the type expected at pos, deduced from the
+// assignment, declaration, call argument, return statement, operation
+// or composite literal enclosing pos.
+func expectedType(paths []ast.Node, pos token.Pos, info *types.Info) types.Type {
+	for i, n := range paths {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE || len(n.Lhs) != len(n.Rhs) {
+				return nil
+			}
+			for j, rhs := range n.Rhs {
+				if rhs.Pos() <= pos && pos <= rhs.End() {
+					return info.TypeOf(n.Lhs[j])
+				}
+			}
+			return nil
+
+		case *ast.ValueSpec:
+			if n.Type == nil {
+				return nil
+			}
+			return info.TypeOf(n.Type)
+
+		case *ast.CallExpr:
+			if pos <= n.Lparen || n.Rparen < pos {
+				continue // e.g. completing the function itself
+			}
+			sig, ok := typeUnder[*types.Signature](info.TypeOf(n.Fun))
+			if !ok {
+				return nil
+			}
+			idx := 0
+			for _, arg := range n.Args {
+				if arg.End() < pos {
+					idx++
+				}
+			}
+			params := sig.Params()
+			switch {
+			case sig.Variadic() && idx >= params.Len()-1:
+				if s, ok := params.At(params.Len() - 1).Type().(*types.Slice); ok {
+					return s.Elem()
+				}
+				return nil
+			case idx < params.Len():
+				return params.At(idx).Type()
+			}
+			return nil
+
+		case *ast.ReturnStmt:
+			idx := 0
+			for _, res := range n.Results {
+				if res.End() < pos {
+					idx++
+				}
+			}
+			sig := enclosingSignature(paths[i:], info)
+			if sig == nil || idx >= sig.Results().Len() {
+				return nil
+			}
+			return sig.Results().At(idx).Type()
+
+		case *ast.BinaryExpr:
+			switch n.Op {
+			case token.LAND, token.LOR:
+				return types.Typ[types.Bool]
+			case token.SHL, token.SHR:
+				return nil
+			}
+			if n.Y.Pos() <= pos {
+				return info.TypeOf(n.X)
+			}
+			return info.TypeOf(n.Y)
+
+		case *ast.KeyValueExpr:
+			if pos < n.Value.Pos() || i+1 >= len(paths) {
+				return nil
+			}
+			lit, ok := paths[i+1].(*ast.CompositeLit)
+			if !ok {
+				return nil
+			}
+			t := info.TypeOf(lit)
+			if t == nil {
+				return nil
+			}
+			return elemType(t.Underlying(), n.Key)
+
+		case *ast.CompositeLit:
+			t := info.TypeOf(n)
+			if t == nil {
+				return nil
+			}
+			return elemType(t.Underlying(), nil)
+
+		case *ast.Ident, *ast.SelectorExpr, *ast.BasicLit, *ast.BadExpr,
+			*ast.UnaryExpr, *ast.StarExpr, *ast.ParenExpr:
+			continue
+
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// elemType returns the type of the elements of the composite type t,
+// key is the key of the element for structs.
+func elemType(t types.Type, key ast.Expr) types.Type {
+	switch t := t.(type) {
+	case *types.Pointer:
+		return elemType(t.Elem().Underlying(), key)
+	case *types.Slice:
+		return t.Elem()
+	case *types.Array:
+		return t.Elem()
+	case *types.Map:
+		return t.Elem()
+	case *types.Struct:
+		id, ok := key.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		for i := 0; i < t.NumFields(); i++ {
+			if t.Field(i).Name() == id.Name {
+				return t.Field(i).Type()
+			}
+		}
+	}
+	return nil
+}
+
+// enclosingSignature returns the signature of the innermost function
+// of paths.
+func enclosingSignature(paths []ast.Node, info *types.Info) *types.Signature {
+	for _, n := range paths {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			sig, _ := info.TypeOf(n).(*types.Signature)
+			return sig
+		case *ast.FuncDecl:
+			if obj := info.Defs[n.Name]; obj != nil {
+				sig, _ := obj.Type().(*types.Signature)
+				return sig
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// typeUnder returns the underlying type of t as T.
+func typeUnder[T types.Type](t types.Type) (T, bool) {
+	var zero T
+	if t == nil {
+		return zero, false
+	}
+	u, ok := t.Underlying().(T)
+	return u, ok
+}
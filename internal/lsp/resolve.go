@@ -0,0 +1,137 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// completionData is sent along with completion items, so their
+// documentation can be resolved on `completionItem/resolve`.
+type completionData struct {
+	URI   protocol.DocumentURI `json:"u,omitempty"`
+	Store bool                 `json:"s,omitempty"` // symbol of the CompletionStore
+	Pkg   string               `json:"p"`           // import path
+	Recv  string               `json:"r,omitempty"` // named type of fields and methods
+	Name  string               `json:"n"`
+}
+
+func (s *server) CompletionResolve(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var item struct {
+		protocol.CompletionItem
+		Data *completionData `json:"data,omitempty"`
+	}
+	if err := json.Unmarshal(req.Params(), &item); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	res := item.CompletionItem
+	data := item.Data
+	if data == nil {
+		return reply(ctx, res, nil)
+	}
+	res.Data = data
+
+	if data.Store {
+		pkg := s.storePackage(data.Pkg)
+		if pkg == nil {
+			return reply(ctx, res, nil)
+		}
+		for _, sym := range pkg.Symbols {
+			if sym.Name == data.Name {
+				res.Detail = sym.Signature
+				res.Documentation = docWithLink(sym.Doc, sym.Name, sym.FileURI.Filename(), sym.Position.Line)
+				break
+			}
+		}
+		return reply(ctx, res, nil)
+	}
+
+	file, ok := s.snapshot.Get(data.URI.Filename())
+	if !ok {
+		return reply(ctx, res, nil)
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return reply(ctx, res, nil)
+	}
+	pkg, ok := s.cache.lookupPackage(data.URI.Filename())
+	if !ok {
+		return reply(ctx, res, nil)
+	}
+	obj := lookupObject(tcr.pkg, data)
+	if obj == nil {
+		return reply(ctx, res, nil)
+	}
+
+	res.Detail = types.ObjectString(obj, types.RelativeTo(tcr.pkg))
+	if p, ok := tcr.objectPosition(obj); ok {
+		res.Documentation = docWithLink(s.objectDoc(pkg, obj), obj.Name(), p.Filename, p.Line)
+	} else if doc := s.objectDoc(pkg, obj); doc != "" {
+		res.Documentation = doc
+	}
+	return reply(ctx, res, nil)
+}
+
+// lookupObject returns the object described by data, found in
+// pkg or in the packages it imports.
+func lookupObject(pkg *types.Package, data *completionData) types.Object {
+	p := findPackage(pkg, data.Pkg, map[*types.Package]bool{})
+	if p == nil {
+		return nil
+	}
+	if data.Recv == "" {
+		return p.Scope().Lookup(data.Name)
+	}
+	tn, ok := p.Scope().Lookup(data.Recv).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(tn.Type()), true, pkg, data.Name)
+	return obj
+}
+
+// findPackage returns the package path among root and its transitive imports.
+func findPackage(root *types.Package, path string, seen map[*types.Package]bool) *types.Package {
+	if root == nil || seen[root] {
+		return nil
+	}
+	seen[root] = true
+	if root.Path() == path {
+		return root
+	}
+	for _, imp := range root.Imports() {
+		if p := findPackage(imp, path, seen); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// namedOf returns the named type of t or *t, if any.
+func namedOf(t types.Type) *types.Named {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, _ := t.(*types.Named)
+	return named
+}
+
+// docWithLink returns doc followed by a link to the definition of
+// name, at line of filename.
+func docWithLink(doc, name, filename string, line int) protocol.MarkupContent {
+	link := fmt.Sprintf("[`%s` on %s:%d](%s#L%d)", name, filepath.Base(filename), line, getURI(filename), line)
+	if doc = strings.TrimSpace(doc); doc != "" {
+		link = doc + "\n\n" + link
+	}
+	return protocol.MarkupContent{
+		Kind:  protocol.Markdown,
+		Value: link,
+	}
+}
@@ -1,6 +1,15 @@
 package lsp
 
-import "go/token"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/token"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+	"golang.org/x/tools/go/ast/astutil"
+)
 
 // A Selection represents the cursor position and surrounding identifier.
 type Selection struct {
@@ -8,3 +17,54 @@ type Selection struct {
 	tokFile            *token.File
 	start, end, cursor token.Pos
 }
+
+func (s *server) SelectionRange(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.SelectionRangeParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	file, ok := s.snapshot.Get(params.TextDocument.URI.Filename())
+	if !ok {
+		return reply(ctx, nil, errors.New("snapshot not found"))
+	}
+	pgf, err := file.ParseGno2(ctx)
+	if err != nil {
+		return reply(ctx, nil, nil)
+	}
+	tf := pgf.Fset.File(pgf.File.Pos())
+
+	ranges := []protocol.SelectionRange{}
+	for _, p := range params.Positions {
+		pos := posFromPosition(tf, p)
+		if !pos.IsValid() {
+			return reply(ctx, nil, errors.New("position out of the file"))
+		}
+		ranges = append(ranges, selectionRange(pgf, pos))
+	}
+	return reply(ctx, ranges, nil)
+}
+
+// selectionRange returns the ranges of the nodes enclosing pos, from
+// the innermost to the whole file.
+func selectionRange(pgf *ParsedGnoFile, pos token.Pos) protocol.SelectionRange {
+	paths, _ := astutil.PathEnclosingInterval(pgf.File, pos, pos)
+
+	// Build the chain from the outermost node
+	var parent *protocol.SelectionRange
+	for i := len(paths) - 1; i >= 0; i-- {
+		rng := protocol.Range{
+			Start: positionOf(pgf.Fset, paths[i].Pos()),
+			End:   positionOf(pgf.Fset, paths[i].End()),
+		}
+		if parent != nil && parent.Range == rng {
+			continue
+		}
+		parent = &protocol.SelectionRange{Range: rng, Parent: parent}
+	}
+	if parent == nil {
+		p := positionOf(pgf.Fset, pos)
+		return protocol.SelectionRange{Range: protocol.Range{Start: p, End: p}}
+	}
+	return *parent
+}
@@ -0,0 +1,416 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// Token types and modifiers of the semantic tokens legend. The index of
+// a type, or the bit of a modifier, is its position in the legend.
+var (
+	semanticTokenTypes = []protocol.SemanticTokenTypes{
+		protocol.SemanticTokenNamespace,
+		protocol.SemanticTokenType,
+		protocol.SemanticTokenStruct,
+		protocol.SemanticTokenInterface,
+		protocol.SemanticTokenTypeParameter,
+		protocol.SemanticTokenParameter,
+		protocol.SemanticTokenVariable,
+		protocol.SemanticTokenProperty,
+		protocol.SemanticTokenFunction,
+		protocol.SemanticTokenMethod,
+	}
+	semanticTokenModifiers = []protocol.SemanticTokenModifiers{
+		protocol.SemanticTokenModifierDeclaration,
+		protocol.SemanticTokenModifierReadonly,
+		protocol.SemanticTokenModifierDeprecated,
+		protocol.SemanticTokenModifierDefaultLibrary,
+		semanticTokenModifierExported,
+		semanticTokenModifierPersisted,
+	}
+)
+
+const (
+	// semanticTokenModifierExported is set on exported identifiers.
+	semanticTokenModifierExported protocol.SemanticTokenModifiers = "exported"
+	// semanticTokenModifierPersisted is set on the package-level
+	// variables of realms, which are persisted between transactions.
+	semanticTokenModifierPersisted protocol.SemanticTokenModifiers = "persisted"
+)
+
+func semanticTokensLegend() protocol.SemanticTokensLegend {
+	return protocol.SemanticTokensLegend{
+		TokenTypes:     semanticTokenTypes,
+		TokenModifiers: semanticTokenModifiers,
+	}
+}
+
+// semanticToken is an identifier of a document, positions are 0-based.
+type semanticToken struct {
+	line, start, length uint32
+	typ                 protocol.SemanticTokenTypes
+	modifiers           []protocol.SemanticTokenModifiers
+}
+
+func (s *server) SemanticTokensFull(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.SemanticTokensParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	tokens, err := s.semanticTokens(params.TextDocument.URI, nil)
+	if err != nil {
+		return reply(ctx, nil, err)
+	}
+	return reply(ctx, s.storeSemanticTokens(params.TextDocument.URI, tokens), nil)
+}
+
+func (s *server) SemanticTokensFullDelta(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.SemanticTokensDeltaParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	uri := params.TextDocument.URI
+	tokens, err := s.semanticTokens(uri, nil)
+	if err != nil {
+		return reply(ctx, nil, err)
+	}
+	prev, ok := s.semanticTokensResults.Get(uri.Filename())
+	res := s.storeSemanticTokens(uri, tokens)
+	if !ok || prev.ResultID != params.PreviousResultID {
+		// Unknown result, send every token
+		return reply(ctx, res, nil)
+	}
+	return reply(ctx, protocol.SemanticTokensDelta{
+		ResultID: res.ResultID,
+		Edits:    semanticTokensEdits(prev.Data, res.Data),
+	}, nil)
+}
+
+func (s *server) SemanticTokensRange(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.SemanticTokensRangeParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	tokens, err := s.semanticTokens(params.TextDocument.URI, &params.Range)
+	if err != nil {
+		return reply(ctx, nil, err)
+	}
+	return reply(ctx, protocol.SemanticTokens{Data: encodeSemanticTokens(tokens)}, nil)
+}
+
+// storeSemanticTokens encodes tokens as the latest result of uri, which
+// `semanticTokens/full/delta` requests are computed against.
+func (s *server) storeSemanticTokens(uri protocol.DocumentURI, tokens []semanticToken) *protocol.SemanticTokens {
+	res := &protocol.SemanticTokens{
+		ResultID: strconv.FormatUint(s.semanticTokensID.Add(1), 10),
+		Data:     encodeSemanticTokens(tokens),
+	}
+	s.semanticTokensResults.Set(uri.Filename(), res)
+	return res
+}
+
+// semanticTokens returns the tokens of the identifiers of uri, within
+// rng if not nil. They are classified using the type-checked package of
+// the file, including unsaved changes.
+func (s *server) semanticTokens(uri protocol.DocumentURI, rng *protocol.Range) ([]semanticToken, error) {
+	file, ok := s.snapshot.Get(uri.Filename())
+	if !ok {
+		return nil, errors.New("snapshot not found")
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil, nil
+	}
+	f, _ := tcr.file(filepath.Base(uri.Filename()))
+	if f == nil {
+		return nil, nil
+	}
+
+	params := paramObjects(tcr, f)
+	deprecated := map[*TypeCheckResult]map[types.Object]bool{}
+	isDeprecated := func(obj types.Object) bool {
+		owner, ok := tcr.owner(obj)
+		if !ok {
+			return false
+		}
+		if _, ok := deprecated[owner]; !ok {
+			deprecated[owner] = deprecatedObjects(owner)
+		}
+		return deprecated[owner][obj]
+	}
+
+	tokens := []semanticToken{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		start := tcr.location(id.Pos(), id.End()).Range.Start
+		if rng != nil && (positionLess(start, rng.Start) || !positionLess(start, rng.End)) {
+			return true
+		}
+		tok := semanticToken{
+			line:   start.Line,
+			start:  start.Character,
+			length: uint32(len(id.Name)),
+		}
+
+		obj, isDef := tcr.info.Defs[id], true
+		if obj == nil {
+			obj, isDef = tcr.info.Uses[id], false
+		}
+		switch {
+		case id == f.Name:
+			tok.typ = protocol.SemanticTokenNamespace
+		case obj == nil:
+			return true
+		default:
+			tok.typ, tok.modifiers = classifyObject(obj, params[obj])
+			if tok.typ == "" {
+				return true
+			}
+			if isDef {
+				tok.modifiers = append(tok.modifiers, protocol.SemanticTokenModifierDeclaration)
+			}
+			if isDeprecated(obj) {
+				tok.modifiers = append(tok.modifiers, protocol.SemanticTokenModifierDeprecated)
+			}
+		}
+		tokens = append(tokens, tok)
+		return true
+	})
+	return tokens, nil
+}
+
+// classifyObject returns the token type and modifiers of obj, param
+// reports whether obj is a parameter or a result of a function.
+func classifyObject(obj types.Object, param bool) (protocol.SemanticTokenTypes, []protocol.SemanticTokenModifiers) {
+	var typ protocol.SemanticTokenTypes
+	var mods []protocol.SemanticTokenModifiers
+
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		typ = protocol.SemanticTokenNamespace
+		if isStdlib(obj.Imported().Path()) {
+			mods = append(mods, protocol.SemanticTokenModifierDefaultLibrary)
+		}
+		return typ, mods
+	case *types.TypeName:
+		switch obj.Type().Underlying().(type) {
+		case *types.Struct:
+			typ = protocol.SemanticTokenStruct
+		case *types.Interface:
+			typ = protocol.SemanticTokenInterface
+		default:
+			typ = protocol.SemanticTokenType
+		}
+		if _, ok := obj.Type().(*types.TypeParam); ok {
+			typ = protocol.SemanticTokenTypeParameter
+		}
+	case *types.Var:
+		switch {
+		case obj.IsField():
+			typ = protocol.SemanticTokenProperty
+		case param:
+			typ = protocol.SemanticTokenParameter
+		default:
+			typ = protocol.SemanticTokenVariable
+		}
+		if pkg := obj.Pkg(); pkg != nil && obj.Parent() == pkg.Scope() && isRealm(pkg.Path()) {
+			mods = append(mods, semanticTokenModifierPersisted)
+		}
+	case *types.Const:
+		typ = protocol.SemanticTokenVariable
+		mods = append(mods, protocol.SemanticTokenModifierReadonly)
+	case *types.Nil:
+		typ = protocol.SemanticTokenVariable
+		mods = append(mods, protocol.SemanticTokenModifierReadonly)
+	case *types.Func:
+		typ = protocol.SemanticTokenFunction
+		if obj.Type().(*types.Signature).Recv() != nil {
+			typ = protocol.SemanticTokenMethod
+		}
+	case *types.Builtin:
+		typ = protocol.SemanticTokenFunction
+	default: // e.g. labels
+		return "", nil
+	}
+
+	if obj.Pkg() == nil || isStdlib(obj.Pkg().Path()) {
+		mods = append(mods, protocol.SemanticTokenModifierDefaultLibrary)
+	}
+	if obj.Exported() && obj.Pkg() != nil && (obj.Parent() == obj.Pkg().Scope() || obj.Parent() == nil) {
+		// package-level objects, fields and methods
+		mods = append(mods, semanticTokenModifierExported)
+	}
+	return typ, mods
+}
+
+// paramObjects returns the parameters and results of the functions of f,
+// including function literals.
+func paramObjects(tcr *TypeCheckResult, f *ast.File) map[types.Object]bool {
+	params := map[types.Object]bool{}
+	add := func(fields *ast.FieldList) {
+		if fields == nil {
+			return
+		}
+		for _, field := range fields.List {
+			for _, name := range field.Names {
+				if obj := tcr.info.Defs[name]; obj != nil {
+					params[obj] = true
+				}
+			}
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			add(n.Recv)
+		case *ast.FuncType:
+			add(n.Params)
+			add(n.Results)
+		}
+		return true
+	})
+	return params
+}
+
+// deprecatedObjects returns the objects of res whose doc comment has a
+// "Deprecated: " paragraph.
+func deprecatedObjects(res *TypeCheckResult) map[types.Object]bool {
+	deprecated := map[types.Object]bool{}
+	add := func(doc *ast.CommentGroup, names ...*ast.Ident) {
+		if !isDeprecated(doc) {
+			return
+		}
+		for _, name := range names {
+			if obj := res.info.Defs[name]; obj != nil {
+				deprecated[obj] = true
+			}
+		}
+	}
+	for _, file := range res.files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				add(n.Doc, n.Name)
+			case *ast.GenDecl:
+				for _, spec := range n.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						doc := spec.Doc
+						if doc == nil && len(n.Specs) == 1 {
+							doc = n.Doc
+						}
+						add(doc, spec.Name)
+					case *ast.ValueSpec:
+						doc := spec.Doc
+						if doc == nil && len(n.Specs) == 1 {
+							doc = n.Doc
+						}
+						add(doc, spec.Names...)
+					}
+				}
+			case *ast.Field:
+				add(n.Doc, n.Names...)
+			}
+			return true
+		})
+	}
+	return deprecated
+}
+
+// isDeprecated reports whether doc has a paragraph starting with
+// "Deprecated: ".
+func isDeprecated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	text := doc.Text()
+	return strings.HasPrefix(text, "Deprecated: ") || strings.Contains(text, "\n\nDeprecated: ")
+}
+
+// isStdlib reports whether path is the import path of a standard
+// library package, i.e. its first element has no dot.
+func isStdlib(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return first != "" && !strings.Contains(first, ".")
+}
+
+// isRealm reports whether path is the import path of a realm.
+func isRealm(path string) bool {
+	return strings.HasPrefix(path, "gno.land/r/")
+}
+
+func positionLess(a, b protocol.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+// encodeSemanticTokens returns the relative encoding of tokens described
+// by the LSP specification.
+func encodeSemanticTokens(tokens []semanticToken) []uint32 {
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].line != tokens[j].line {
+			return tokens[i].line < tokens[j].line
+		}
+		return tokens[i].start < tokens[j].start
+	})
+	types := map[protocol.SemanticTokenTypes]uint32{}
+	for i, t := range semanticTokenTypes {
+		types[t] = uint32(i)
+	}
+	modifiers := map[protocol.SemanticTokenModifiers]uint32{}
+	for i, m := range semanticTokenModifiers {
+		modifiers[m] = 1 << i
+	}
+
+	data := make([]uint32, 0, 5*len(tokens))
+	var line, start uint32
+	for _, tok := range tokens {
+		if tok.line != line {
+			start = 0
+		}
+		var mods uint32
+		for _, m := range tok.modifiers {
+			mods |= modifiers[m]
+		}
+		data = append(data, tok.line-line, tok.start-start, tok.length, types[tok.typ], mods)
+		line, start = tok.line, tok.start
+	}
+	return data
+}
+
+// semanticTokensEdits returns the edit turning the encoded tokens prev
+// into next: the range between their common prefix and suffix.
+func semanticTokensEdits(prev, next []uint32) []protocol.SemanticTokensEdit {
+	prefix := 0
+	for prefix < len(prev) && prefix < len(next) && prev[prefix] == next[prefix] {
+		prefix++
+	}
+	if prefix == len(prev) && prefix == len(next) {
+		return []protocol.SemanticTokensEdit{}
+	}
+	suffix := 0
+	for suffix < len(prev)-prefix && suffix < len(next)-prefix &&
+		prev[len(prev)-1-suffix] == next[len(next)-1-suffix] {
+		suffix++
+	}
+	return []protocol.SemanticTokensEdit{{
+		Start:       uint32(prefix),
+		DeleteCount: uint32(len(prev) - prefix - suffix),
+		Data:        next[prefix : len(next)-suffix],
+	}}
+}
@@ -0,0 +1,32 @@
+package lsp
+
+import (
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestSemanticTokensResultsClosed(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/r/demo/foo/foo.gno": "package foo\n\n/*use*/var X = 1\n",
+	})
+	doc := protocol.TextDocumentIdentifier{URI: locs["use"].URI}
+
+	for i := 0; i < 2; i++ {
+		var res protocol.SemanticTokens
+		if err := request(t, s, "textDocument/semanticTokens/full", protocol.SemanticTokensParams{TextDocument: doc}, &res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.semanticTokensResults.Count(); n != 1 {
+		t.Errorf("%d results kept, want 1", n)
+	}
+
+	var res any
+	if err := request(t, s, "textDocument/didClose", protocol.DidCloseTextDocumentParams{TextDocument: doc}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.semanticTokensResults.Count(); n != 0 {
+		t.Errorf("%d results kept after close, want 0", n)
+	}
+}
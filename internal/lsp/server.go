@@ -6,7 +6,11 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
 
+	cmap "github.com/orcaman/concurrent-map/v2"
 	"go.lsp.dev/jsonrpc2"
 	"go.lsp.dev/protocol"
 
@@ -19,34 +23,77 @@ type server struct {
 	conn jsonrpc2.Conn
 	env  *env.Env
 
-	snapshot        *Snapshot
-	completionStore *CompletionStore
-	cache           *Cache
+	snapshot *Snapshot
+	cache    *Cache
+	// completionStore is replaced by `gnopls.reindex` while requests
+	// and commands may read it.
+	completionStore atomic.Pointer[CompletionStore]
+	// workspace are the packages of the Cache and of the
+	// CompletionStore type-checked together, see checkPackages.
+	workspace   *workspaceCheck
+	workspaceMu sync.Mutex
 
 	formatOpt tools.FormattingOption
+
+	// capabilities are the client capabilities sent in `initialize`.
+	capabilities protocol.ClientCapabilities
+	// diagnosticCapabilities are its pull diagnostics capabilities.
+	diagnosticCapabilities diagnosticClientCapabilities
+	// workspaceDirs are the directories of the workspace folders sent in
+	// `initialize`.
+	workspaceDirs []string
+
+	// semanticTokensResults are the latest semantic tokens sent for
+	// each document, keyed by filename.
+	semanticTokensResults cmap.ConcurrentMap[string, *protocol.SemanticTokens]
+	semanticTokensID      atomic.Uint64
+
+	// buildErrors are the errors of the latest build of each package,
+	// keyed by directory.
+	buildErrors cmap.ConcurrentMap[string, []ErrorInfo]
+	// testFailures are the failures of the latest `gno test` of each
+	// package, keyed by directory.
+	testFailures cmap.ConcurrentMap[string, []ErrorInfo]
+	// diagnosedFiles are the files with published diagnostics, keyed by
+	// filename.
+	diagnosedFiles cmap.ConcurrentMap[string, bool]
+
+	settings settings
 }
 
 func BuildServerHandler(conn jsonrpc2.Conn, e *env.Env) jsonrpc2.Handler {
-	dirs := []string{}
-	if e.GNOROOT != "" {
-		dirs = append(dirs, filepath.Join(e.GNOROOT, "examples"))
-		dirs = append(dirs, filepath.Join(e.GNOROOT, "gnovm/stdlibs"))
-	}
+	dirs := completionStoreDirs(e)
 	server := &server{
 		conn: conn,
 
 		env: e,
 
-		snapshot:        NewSnapshot(),
-		completionStore: InitCompletionStore(dirs),
-		cache:           NewCache(),
+		snapshot: NewSnapshot(),
+		cache:    NewCache(),
+
+		semanticTokensResults: cmap.New[*protocol.SemanticTokens](),
+		buildErrors:           cmap.New[[]ErrorInfo](),
+		testFailures:          cmap.New[[]ErrorInfo](),
+		diagnosedFiles:        cmap.New[bool](),
 
 		formatOpt: tools.Gofumpt,
+		settings:  defaultSettings(),
 	}
+	server.completionStore.Store(InitCompletionStore(dirs))
 	env.GlobalEnv = e
 	return jsonrpc2.ReplyHandler(server.ServerHandler)
 }
 
+// completionStoreDirs returns the dirs indexed by the CompletionStore.
+func completionStoreDirs(e *env.Env) []string {
+	dirs := []string{}
+	if e.GNOROOT != "" {
+		dirs = append(dirs, filepath.Join(e.GNOROOT, "examples"))
+		dirs = append(dirs, filepath.Join(e.GNOROOT, "gnovm/stdlibs"))
+	}
+	return dirs
+}
+
 func (s *server) ServerHandler(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
 	switch req.Method() {
 	case "exit":
@@ -71,8 +118,54 @@ func (s *server) ServerHandler(ctx context.Context, reply jsonrpc2.Replier, req
 		return s.Hover(ctx, reply, req)
 	case "textDocument/completion":
 		return s.Completion(ctx, reply, req)
+	case "completionItem/resolve":
+		return s.CompletionResolve(ctx, reply, req)
 	case "textDocument/definition":
 		return s.Definition(ctx, reply, req)
+	case "textDocument/typeDefinition":
+		return s.TypeDefinition(ctx, reply, req)
+	case "textDocument/documentHighlight":
+		return s.DocumentHighlight(ctx, reply, req)
+	case "textDocument/implementation":
+		return s.Implementation(ctx, reply, req)
+	case "textDocument/prepareCallHierarchy":
+		return s.PrepareCallHierarchy(ctx, reply, req)
+	case "callHierarchy/incomingCalls":
+		return s.IncomingCalls(ctx, reply, req)
+	case "callHierarchy/outgoingCalls":
+		return s.OutgoingCalls(ctx, reply, req)
+	case "textDocument/prepareTypeHierarchy":
+		return s.PrepareTypeHierarchy(ctx, reply, req)
+	case "typeHierarchy/supertypes":
+		return s.Supertypes(ctx, reply, req)
+	case "typeHierarchy/subtypes":
+		return s.Subtypes(ctx, reply, req)
+	case "textDocument/semanticTokens/full":
+		return s.SemanticTokensFull(ctx, reply, req)
+	case "textDocument/semanticTokens/full/delta":
+		return s.SemanticTokensFullDelta(ctx, reply, req)
+	case "textDocument/semanticTokens/range":
+		return s.SemanticTokensRange(ctx, reply, req)
+	case "textDocument/inlayHint":
+		return s.InlayHint(ctx, reply, req)
+	case "textDocument/foldingRange":
+		return s.FoldingRange(ctx, reply, req)
+	case "textDocument/selectionRange":
+		return s.SelectionRange(ctx, reply, req)
+	case "textDocument/documentLink":
+		return s.DocumentLink(ctx, reply, req)
+	case "textDocument/codeAction":
+		return s.CodeAction(ctx, reply, req)
+	case "textDocument/codeLens":
+		return s.CodeLens(ctx, reply, req)
+	case "textDocument/diagnostic":
+		return s.DocumentDiagnostic(ctx, reply, req)
+	case "workspace/diagnostic":
+		return s.WorkspaceDiagnostic(ctx, reply, req)
+	case "workspace/didChangeConfiguration":
+		return s.DidChangeConfiguration(ctx, reply, req)
+	case "workspace/executeCommand":
+		return s.ExecuteCommand(ctx, reply, req)
 	default:
 		return jsonrpc2.MethodNotFoundHandler(ctx, reply, req)
 	}
@@ -83,36 +176,111 @@ func (s *server) Initialize(ctx context.Context, reply jsonrpc2.Replier, req jso
 	if err := json.Unmarshal(req.Params(), &params); err != nil {
 		return sendParseError(ctx, reply, err)
 	}
+	s.capabilities = params.Capabilities
+	var diagnosticParams struct {
+		Capabilities diagnosticClientCapabilities `json:"capabilities"`
+	}
+	if err := json.Unmarshal(req.Params(), &diagnosticParams); err == nil {
+		s.diagnosticCapabilities = diagnosticParams.Capabilities
+	}
+	for _, folder := range params.WorkspaceFolders {
+		s.workspaceDirs = append(s.workspaceDirs, protocol.DocumentURI(folder.URI).Filename())
+	}
+	if len(s.workspaceDirs) == 0 && params.RootURI != "" {
+		s.workspaceDirs = append(s.workspaceDirs, params.RootURI.Filename())
+	}
+	if params.InitializationOptions != nil {
+		if err := s.settings.update(params.InitializationOptions); err != nil {
+			slog.Error("invalid initializationOptions", "err", err)
+		}
+	}
 
-	return reply(ctx, protocol.InitializeResult{
+	return reply(ctx, initializeResult{
 		ServerInfo: &protocol.ServerInfo{
 			Name:    "gnopls",
 			Version: version.GetVersion(ctx),
 		},
-		Capabilities: protocol.ServerCapabilities{
-			TextDocumentSync: protocol.TextDocumentSyncOptions{
-				Change:    protocol.TextDocumentSyncKindFull,
-				OpenClose: true,
-				Save: &protocol.SaveOptions{
-					IncludeText: true,
+		Capabilities: serverCapabilities{
+			ServerCapabilities: protocol.ServerCapabilities{
+				TextDocumentSync: protocol.TextDocumentSyncOptions{
+					Change:    protocol.TextDocumentSyncKindFull,
+					OpenClose: true,
+					Save: &protocol.SaveOptions{
+						IncludeText: true,
+					},
 				},
-			},
-			CompletionProvider: &protocol.CompletionOptions{
-				TriggerCharacters: []string{"."},
-				ResolveProvider:   false,
-			},
-			HoverProvider: true,
-			ExecuteCommandProvider: &protocol.ExecuteCommandOptions{
-				Commands: []string{
-					"gnopls.version",
+				CompletionProvider: &protocol.CompletionOptions{
+					TriggerCharacters: []string{"."},
+					ResolveProvider:   true,
+				},
+				HoverProvider:      true,
+				CodeActionProvider: true,
+				CodeLensProvider: &protocol.CodeLensOptions{
+					ResolveProvider: false,
+				},
+				DocumentLinkProvider: &protocol.DocumentLinkOptions{
+					ResolveProvider: false,
+				},
+				ExecuteCommandProvider: &protocol.ExecuteCommandOptions{
+					Commands: commandNames(),
+				},
+				DefinitionProvider:         true,
+				TypeDefinitionProvider:     true,
+				ImplementationProvider:     true,
+				CallHierarchyProvider:      true,
+				DocumentHighlightProvider:  true,
+				FoldingRangeProvider:       true,
+				SelectionRangeProvider:     true,
+				DocumentFormattingProvider: true,
+				SemanticTokensProvider: semanticTokensOptions{
+					Legend: semanticTokensLegend(),
+					Range:  true,
+					Full:   &semanticTokensFullOptions{Delta: true},
 				},
 			},
-			DefinitionProvider:         true,
-			DocumentFormattingProvider: true,
+			TypeHierarchyProvider: true,
+			InlayHintProvider:     true,
+			DiagnosticProvider: &diagnosticOptions{
+				InterFileDependencies: true,
+				WorkspaceDiagnostics:  true,
+			},
 		},
 	}, nil)
 }
 
+// snippetSupport reports whether the client accepts snippets as
+// completion insert text.
+func (s *server) snippetSupport() bool {
+	td := s.capabilities.TextDocument
+	if td == nil || td.Completion == nil || td.Completion.CompletionItem == nil {
+		return false
+	}
+	return td.Completion.CompletionItem.SnippetSupport
+}
+
+// pullDiagnostics reports whether the client pulls diagnostics, which are
+// then not published.
+func (s *server) pullDiagnostics() bool {
+	return s.diagnosticCapabilities.TextDocument.Diagnostic != nil
+}
+
+// diagnosticRefreshSupport reports whether the client can be asked to
+// pull diagnostics again.
+func (s *server) diagnosticRefreshSupport() bool {
+	d := s.diagnosticCapabilities.Workspace.Diagnostics
+	return d != nil && d.RefreshSupport
+}
+
+// resourceOperationSupport reports whether the client accepts the
+// resource operation kind in workspace edits.
+func (s *server) resourceOperationSupport(kind protocol.ResourceOperationKind) bool {
+	ws := s.capabilities.Workspace
+	if ws == nil || ws.WorkspaceEdit == nil {
+		return false
+	}
+	return slices.Contains(ws.WorkspaceEdit.ResourceOperations, string(kind))
+}
+
 func (s *server) Initialized(ctx context.Context, reply jsonrpc2.Replier, _ jsonrpc2.Request) error {
 	slog.Info("initialized")
 	return reply(ctx, nil, nil)
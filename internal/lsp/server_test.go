@@ -0,0 +1,142 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+
+	"github.com/harry-hov/gnopls/internal/env"
+)
+
+// testServer returns a server whose GNOROOT is a temporary directory.
+// Files are written to its `examples`, keyed by their path relative to
+// it, with their markers removed (see markers). The packages of the
+// files whose path has a marker are opened.
+//
+// It sets env.GlobalEnv, so tests using it can't run in parallel.
+func testServer(t *testing.T, files map[string]string) (*server, map[string]protocol.Location) {
+	t.Helper()
+	root := t.TempDir()
+	e := &env.Env{GNOROOT: root, GNOHOME: t.TempDir()}
+	env.GlobalEnv = e
+	s := &server{
+		conn:                  nopConn{},
+		env:                   e,
+		snapshot:              NewSnapshot(),
+		cache:                 NewCache(),
+		semanticTokensResults: cmap.New[*protocol.SemanticTokens](),
+		buildErrors:           cmap.New[[]ErrorInfo](),
+		testFailures:          cmap.New[[]ErrorInfo](),
+		diagnosedFiles:        cmap.New[bool](),
+		settings:              defaultSettings(),
+	}
+
+	s.completionStore.Store(InitCompletionStore(nil))
+
+	locs := map[string]protocol.Location{}
+	var opened []string
+	for name, src := range files {
+		filename := filepath.Join(root, "examples", filepath.FromSlash(name))
+		src, m := markers(src)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for marker, p := range m {
+			locs[marker] = protocol.Location{URI: getURI(filename), Range: protocol.Range{Start: p, End: p}}
+		}
+		if len(m) > 0 {
+			opened = append(opened, filename)
+		}
+	}
+	for _, filename := range opened {
+		src, _ := os.ReadFile(filename)
+		s.snapshot.file.Set(filename, &GnoFile{URI: getURI(filename), Src: src})
+		s.UpdateCache(filepath.Dir(filename))
+	}
+	return s, locs
+}
+
+var markerRe = regexp.MustCompile(`/\*(\w+)\*/`)
+
+// markers removes the `/*name*/` markers of src, and returns the
+// positions they were at.
+func markers(src string) (string, map[string]protocol.Position) {
+	m := map[string]protocol.Position{}
+	var b strings.Builder
+	line, col := 0, 0
+	last := 0
+	advance := func(s string) {
+		b.WriteString(s)
+		for _, r := range s {
+			if r == '\n' {
+				line, col = line+1, 0
+			} else {
+				col++
+			}
+		}
+	}
+	for _, loc := range markerRe.FindAllStringSubmatchIndex(src, -1) {
+		advance(src[last:loc[0]])
+		m[src[loc[2]:loc[3]]] = protocol.Position{Line: uint32(line), Character: uint32(col)}
+		last = loc[1]
+	}
+	advance(src[last:])
+	return b.String(), m
+}
+
+// request calls the handler of method with params, and unmarshals its
+// result into res.
+func request(t *testing.T, s *server, method string, params, res any) error {
+	t.Helper()
+	b, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := jsonrpc2.NewCall(jsonrpc2.NewNumberID(1), method, json.RawMessage(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result any
+	var rerr error
+	replier := func(_ context.Context, r interface{}, err error) error {
+		result, rerr = r, err
+		return nil
+	}
+	if err := s.ServerHandler(context.Background(), replier, req); err != nil {
+		t.Fatal(err)
+	}
+	if rerr != nil {
+		return rerr
+	}
+	b, err = json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, res); err != nil {
+		t.Fatal(err)
+	}
+	return nil
+}
+
+// nopConn is a client connection ignoring the messages sent to it.
+type nopConn struct{}
+
+func (nopConn) Call(context.Context, string, interface{}, interface{}) (jsonrpc2.ID, error) {
+	return jsonrpc2.NewNumberID(0), nil
+}
+func (nopConn) Notify(context.Context, string, interface{}) error { return nil }
+func (nopConn) Go(context.Context, jsonrpc2.Handler)              {}
+func (nopConn) Close() error                                      { return nil }
+func (nopConn) Done() <-chan struct{}                             { return nil }
+func (nopConn) Err() error                                        { return nil }
@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// settings are the user settings, sent as `initializationOptions` and
+// with `workspace/didChangeConfiguration`, either at the top level or
+// under a "gnopls" key. Missing settings keep their current value.
+type settings struct {
+	Hints hintSettings `json:"hints"`
+
+	// GnowebURL is the base URL of the gnoweb instance gno.land paths
+	// are linked to, e.g. a local gnodev. If empty, imports are linked
+	// to their local directory and other paths to gno.land.
+	GnowebURL string `json:"gnowebURL"`
+}
+
+// hintSettings enable the categories of inlay hints.
+type hintSettings struct {
+	// ParameterNames shows the names of parameters at call sites.
+	ParameterNames bool `json:"parameterNames"`
+	// AssignVariableTypes shows the types of variables declared with `:=`.
+	AssignVariableTypes bool `json:"assignVariableTypes"`
+	// ConstantValues shows the values of constants which aren't literals,
+	// e.g. using `iota`.
+	ConstantValues bool `json:"constantValues"`
+	// CompositeLiteralFields shows the field names of unkeyed struct
+	// literals.
+	CompositeLiteralFields bool `json:"compositeLiteralFields"`
+	// PersistedState marks the package-level variables of realms, which
+	// are persisted on-chain.
+	PersistedState bool `json:"persistedState"`
+}
+
+func defaultSettings() settings {
+	return settings{
+		Hints: hintSettings{
+			ParameterNames:         true,
+			AssignVariableTypes:    true,
+			ConstantValues:         true,
+			CompositeLiteralFields: true,
+			PersistedState:         true,
+		},
+	}
+}
+
+// update updates s with the settings v.
+func (s *settings) update(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var nested struct {
+		Gnopls json.RawMessage `json:"gnopls"`
+	}
+	if err := json.Unmarshal(b, &nested); err == nil && nested.Gnopls != nil {
+		b = nested.Gnopls
+	}
+	if string(b) == "null" {
+		return nil
+	}
+	return json.Unmarshal(b, s)
+}
+
+func (s *server) DidChangeConfiguration(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params protocol.DidChangeConfigurationParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	if err := s.settings.update(params.Settings); err != nil {
+		slog.Error("invalid settings", "err", err)
+	}
+	return reply(ctx, nil, nil)
+}
@@ -0,0 +1,427 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"go.lsp.dev/protocol"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// refactorChangeSignature is the kind of the code actions changing the
+// parameters of a function.
+const refactorChangeSignature protocol.CodeActionKind = "refactor.rewrite.changeSignature"
+
+// changeSignatureArgs are the arguments of `gnopls.changeSignature`.
+type changeSignatureArgs struct {
+	// URI and Position locate the function, at its declaration or at
+	// one of its uses.
+	URI      protocol.DocumentURI `json:"uri"`
+	Position protocol.Position    `json:"position"`
+
+	// Params are the parameters of the new signature, in order.
+	Params []paramSpec `json:"params"`
+}
+
+// paramSpec is a parameter of a new signature: either an existing
+// parameter, by its index in the current signature, or a new parameter,
+// with a name and a type. Call sites pass the zero value of the type to
+// new parameters.
+type paramSpec struct {
+	From *int   `json:"from,omitempty"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// cmdChangeSignature changes the parameters of a function, and updates
+// its call sites in the packages of the Cache.
+func cmdChangeSignature(ctx context.Context, s *server, args changeSignatureArgs) (any, error) {
+	edit, err := s.changeSignature(args)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := s.applyEdit(context.WithoutCancel(ctx), "Change signature", *edit); err != nil {
+			s.showMessage(ctx, protocol.MessageTypeError, err.Error())
+		}
+	}()
+	return nil, nil
+}
+
+// codeActionsChangeSignature returns the code actions removing and
+// moving the parameter at the start of rng, in a function declaration.
+func (s *server) codeActionsChangeSignature(file *GnoFile, rng protocol.Range) []protocol.CodeAction {
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil
+	}
+	f, tf := tcr.file(filepath.Base(file.URI.Filename()))
+	if f == nil {
+		return nil
+	}
+	pos := posFromPosition(tf, rng.Start)
+	if !pos.IsValid() {
+		return nil
+	}
+	id, obj := tcr.identAt(f, pos)
+	v, ok := obj.(*types.Var)
+	if !ok || tcr.info.Defs[id] != v {
+		return nil
+	}
+	path, _ := astutil.PathEnclosingInterval(f, id.Pos(), id.End())
+	if len(path) < 4 {
+		return nil
+	}
+	fields, ok := path[2].(*ast.FieldList)
+	if !ok {
+		return nil
+	}
+	decl, ok := path[3].(*ast.FuncDecl) // the FuncType is skipped
+	if !ok || decl.Type.Params != fields {
+		return nil
+	}
+	params := declParams(decl)
+	index := -1
+	for i, p := range params {
+		if p.name == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+
+	actions := []protocol.CodeAction{}
+	add := func(title string, order []int) {
+		specs := make([]paramSpec, len(order))
+		for i := range order {
+			specs[i].From = &order[i]
+		}
+		actions = append(actions, protocol.CodeAction{
+			Title: title,
+			Kind:  refactorChangeSignature,
+			Command: &protocol.Command{
+				Title:   title,
+				Command: "gnopls.changeSignature",
+				Arguments: []interface{}{changeSignatureArgs{
+					URI:      file.URI,
+					Position: positionOf(tcr.fset, decl.Name.Pos()),
+					Params:   specs,
+				}},
+			},
+		})
+	}
+	order := func(swap int) []int {
+		res := make([]int, len(params))
+		for i := range res {
+			res[i] = i
+		}
+		if swap >= 0 {
+			res[swap], res[swap+1] = res[swap+1], res[swap]
+		}
+		return res
+	}
+
+	if !paramUsed(tcr.info, decl, v) {
+		removed := order(-1)
+		add("Remove parameter "+v.Name(), append(removed[:index], removed[index+1:]...))
+	}
+	if index > 0 && !params[index].variadic {
+		add("Move parameter "+v.Name()+" left", order(index-1))
+	}
+	if index < len(params)-1 && !params[index+1].variadic {
+		add("Move parameter "+v.Name()+" right", order(index))
+	}
+	return actions
+}
+
+// declParam is a parameter of a function declaration.
+type declParam struct {
+	name     *ast.Ident // nil if unnamed
+	typ      ast.Expr
+	variadic bool
+}
+
+// declParams returns the parameters of decl, one per name.
+func declParams(decl *ast.FuncDecl) []declParam {
+	var params []declParam
+	for _, field := range decl.Type.Params.List {
+		_, variadic := field.Type.(*ast.Ellipsis)
+		if len(field.Names) == 0 {
+			params = append(params, declParam{typ: field.Type, variadic: variadic})
+		}
+		for _, name := range field.Names {
+			params = append(params, declParam{name: name, typ: field.Type, variadic: variadic})
+		}
+	}
+	return params
+}
+
+// paramUsed reports whether the parameter v is used in the body of decl.
+func paramUsed(info *types.Info, decl *ast.FuncDecl, v *types.Var) bool {
+	used := false
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && info.Uses[id] == v {
+			used = true
+		}
+		return !used
+	})
+	return used
+}
+
+// changeSignature returns the edit applying args to the declaration of
+// the function and to its call sites.
+func (s *server) changeSignature(args changeSignatureArgs) (*protocol.WorkspaceEdit, error) {
+	file, ok := s.snapshot.Get(args.URI.Filename())
+	if !ok {
+		return nil, errors.New("snapshot not found")
+	}
+	tcr, f, pos, ok := s.typeCheckPosition(file, args.Position)
+	if !ok {
+		return nil, errors.New("cannot type-check the package")
+	}
+	_, obj := tcr.identAt(f, pos)
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return nil, errors.New("no function at position")
+	}
+	sameFunc := func(obj types.Object) bool {
+		other, ok := obj.(*types.Func)
+		return ok && other.Pkg() != nil && other.Pkg().Path() == fn.Pkg().Path() && other.FullName() == fn.FullName()
+	}
+
+	// The packages to update, starting with the one declaring fn, then
+	// the test variants of packages and the filetests
+	pkgs := s.checkPackages(tcr, false)
+	for _, m := range []cmap.ConcurrentMap[string, *Package]{s.cache.tests, s.cache.filetests} {
+		for _, pkg := range m.Items() {
+			if res := pkg.TypeCheckResult; res != nil && res.pkg != nil && res.pkginfo != nil {
+				pkgs = append(pkgs, res)
+			}
+		}
+	}
+	var owner *TypeCheckResult
+	var decl *ast.FuncDecl
+	for _, res := range pkgs {
+		if res.pkg.Path() == fn.Pkg().Path() {
+			owner, decl = res, funcDecl(res, fn.FullName())
+			break
+		}
+	}
+	if decl == nil {
+		return nil, fmt.Errorf("%s is not declared in the workspace", fn.Name())
+	}
+	if decl.Type.TypeParams != nil {
+		return nil, fmt.Errorf("%s is generic", fn.Name())
+	}
+
+	// Check the new parameters
+	params := declParams(decl)
+	kept := map[int]bool{}
+	newTypes := make([]types.Type, len(args.Params))
+	for i, spec := range args.Params {
+		if spec.From != nil {
+			from := *spec.From
+			if from < 0 || from >= len(params) || kept[from] {
+				return nil, fmt.Errorf("invalid parameter index %d", from)
+			}
+			if params[from].variadic && i != len(args.Params)-1 {
+				return nil, errors.New("the variadic parameter must be last")
+			}
+			kept[from] = true
+			continue
+		}
+		if !token.IsIdentifier(spec.Name) {
+			return nil, fmt.Errorf("invalid parameter name %q", spec.Name)
+		}
+		tv, err := types.Eval(owner.fset, owner.pkg, decl.Pos(), spec.Type)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type %q: %w", spec.Type, err)
+		}
+		if !tv.IsType() {
+			return nil, fmt.Errorf("%q is not a type", spec.Type)
+		}
+		newTypes[i] = tv.Type
+	}
+	for i, p := range params {
+		if p.name == nil || kept[i] {
+			continue
+		}
+		if v, ok := owner.info.Defs[p.name].(*types.Var); ok && paramUsed(owner.info, decl, v) {
+			return nil, fmt.Errorf("parameter %s is used", p.name.Name)
+		}
+	}
+
+	// Rewrite the declaration and the call sites, file by file
+	edit := &protocol.WorkspaceEdit{Changes: map[protocol.DocumentURI][]protocol.TextEdit{}}
+	for _, res := range pkgs {
+		for _, f := range res.files {
+			uri := res.location(f.Pos(), f.Pos()).URI
+			if _, ok := edit.Changes[uri]; ok {
+				continue // e.g. in the test variant of a package
+			}
+			tf := res.fset.File(f.Pos())
+			rf := &refactoring{tcr: res, f: f, tf: tf, src: res.source(tf.Name())}
+			if rf.src == nil {
+				continue
+			}
+			fi := newFileImports(res.pkg, f)
+			var replacements []replacement
+
+			if res == owner && decl.Pos() >= f.Pos() && decl.End() <= f.End() {
+				list := make([]string, len(args.Params))
+				for i, spec := range args.Params {
+					if spec.From == nil {
+						list[i] = spec.Name + " " + spec.Type
+						continue
+					}
+					p := params[*spec.From]
+					name := "_"
+					if p.name != nil {
+						name = p.name.Name
+					}
+					list[i] = name + " " + rf.text(p.typ.Pos(), p.typ.End())
+				}
+				fields := decl.Type.Params
+				replacements = append(replacements, replacement{fields.Opening + 1, fields.Closing, strings.Join(list, ", ")})
+			}
+
+			var err error
+			parents := parentsOf(f)
+			ast.Inspect(f, func(n ast.Node) bool {
+				id, ok := n.(*ast.Ident)
+				if !ok || err != nil || !sameFunc(res.info.Uses[id]) {
+					return err == nil
+				}
+				var fun ast.Node = id
+				if sel, ok := parents[id].(*ast.SelectorExpr); ok && sel.Sel == id {
+					fun = sel
+				}
+				call, ok := parents[fun].(*ast.CallExpr)
+				if !ok || call.Fun != fun {
+					err = fmt.Errorf("%s: %s is not called", res.fset.Position(id.Pos()), fn.Name())
+					return false
+				}
+				var text string
+				text, err = rf.callArgs(call, params, args.Params, newTypes, fi.qualifier)
+				if err != nil {
+					err = fmt.Errorf("%s: %w", res.fset.Position(call.Pos()), err)
+					return false
+				}
+				replacements = append(replacements, replacement{call.Lparen + 1, call.Rparen, text})
+				return true
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(replacements) == 0 {
+				continue
+			}
+
+			sort.Slice(replacements, func(i, j int) bool { return replacements[i].pos < replacements[j].pos })
+			for i := 1; i < len(replacements); i++ {
+				if replacements[i].pos < replacements[i-1].end {
+					return nil, fmt.Errorf("%s: nested calls to %s are not supported", res.fset.Position(replacements[i].pos), fn.Name())
+				}
+			}
+			src, err := fi.addImports(rf.splice(replacements...))
+			if err != nil {
+				return nil, err
+			}
+			fileEdit, err := s.formattedEdit(uri, src)
+			if err != nil {
+				return nil, err
+			}
+			edit.Changes[uri] = fileEdit.Changes[uri]
+		}
+	}
+	return edit, nil
+}
+
+// callArgs returns the arguments of call for the parameters specs, the
+// function having the parameters params. New parameters are passed the
+// zero value of their type in newTypes.
+func (rf *refactoring) callArgs(call *ast.CallExpr, params []declParam, specs []paramSpec, newTypes []types.Type, qf types.Qualifier) (string, error) {
+	// The arguments of each parameter, the variadic one taking the rest
+	args := make([]string, len(params))
+	variadic := len(params) > 0 && params[len(params)-1].variadic
+	if len(call.Args) == 1 && len(params) > 1 {
+		if _, ok := rf.tcr.info.TypeOf(call.Args[0]).(*types.Tuple); ok {
+			return "", errors.New("cannot split a multi-value argument")
+		}
+	}
+	if !variadic && len(call.Args) != len(params) || variadic && len(call.Args) < len(params)-1 {
+		return "", errors.New("wrong number of arguments")
+	}
+	for i, arg := range call.Args {
+		if variadic && i >= len(params)-1 {
+			break
+		}
+		args[i] = rf.text(arg.Pos(), arg.End())
+	}
+	if variadic {
+		rest := call.Args[len(params)-1:]
+		if len(rest) > 0 {
+			args[len(params)-1] = rf.text(rest[0].Pos(), rest[len(rest)-1].End())
+			if call.Ellipsis.IsValid() {
+				args[len(params)-1] += "..."
+			}
+		}
+	}
+
+	// The arguments are evaluated in their new order: refuse to drop
+	// side effects or to reorder them.
+	param := func(i int) int {
+		if variadic && i >= len(params)-1 {
+			return len(params) - 1
+		}
+		return i
+	}
+	kept := map[int]bool{}
+	for _, spec := range specs {
+		if spec.From != nil {
+			kept[*spec.From] = true
+		}
+	}
+	impure := 0
+	for i, arg := range call.Args {
+		if isPure(arg, rf.tcr.info) {
+			continue
+		}
+		if !kept[param(i)] {
+			return "", fmt.Errorf("cannot remove argument %s: it may have side effects", rf.text(arg.Pos(), arg.End()))
+		}
+		impure++
+	}
+	if impure > 1 {
+		last := -1
+		for _, spec := range specs {
+			if spec.From == nil || args[*spec.From] == "" {
+				continue
+			}
+			if *spec.From < last {
+				return "", errors.New("cannot reorder arguments with side effects")
+			}
+			last = *spec.From
+		}
+	}
+
+	var list []string
+	for i, spec := range specs {
+		switch {
+		case spec.From == nil:
+			list = append(list, zeroValue(newTypes[i], qf))
+		case args[*spec.From] != "":
+			list = append(list, args[*spec.From])
+		}
+	}
+	return strings.Join(list, ", "), nil
+}
@@ -0,0 +1,141 @@
+package lsp
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChangeSignature(t *testing.T) {
+	const decl = `package foo
+
+func log() int { return 0 }
+
+func /*fn*/Add(a, b int, rest ...int) int {
+	return a
+}
+
+`
+	zero, one, two := 0, 1, 2
+	tests := []struct {
+		name  string
+		call  string
+		specs []paramSpec
+		want  string // line of the result, refused if empty
+	}{
+		{
+			name:  "remove pure argument",
+			call:  "var x = Add(1, 2)",
+			specs: []paramSpec{{From: &zero}, {From: &two}},
+			want:  "var x = Add(1)",
+		},
+		{
+			name:  "remove impure argument",
+			call:  "var x = Add(1, log())",
+			specs: []paramSpec{{From: &zero}, {From: &two}},
+		},
+		{
+			name:  "remove impure variadic argument",
+			call:  "var x = Add(1, 2, log())",
+			specs: []paramSpec{{From: &zero}},
+		},
+		{
+			name:  "reorder one impure argument",
+			call:  "var x = Add(log(), 2)",
+			specs: []paramSpec{{From: &one}, {From: &zero}, {From: &two}},
+			want:  "var x = Add(2, log())",
+		},
+		{
+			name:  "reorder impure arguments",
+			call:  "var x = Add(log(), log())",
+			specs: []paramSpec{{From: &one}, {From: &zero}, {From: &two}},
+		},
+		{
+			name:  "add after impure arguments",
+			call:  "var x = Add(log(), log())",
+			specs: []paramSpec{{From: &zero}, {From: &one}, {Name: "c", Type: "int"}, {From: &two}},
+			want:  "var x = Add(log(), log(), 0)",
+		},
+		{
+			name:  "missing argument",
+			call:  "var x = Add(1)",
+			specs: []paramSpec{{From: &zero}, {From: &one}},
+		},
+		{
+			name:  "add after variadic",
+			call:  "var x = Add(1, 2)",
+			specs: []paramSpec{{From: &zero}, {From: &one}, {From: &two}, {Name: "c", Type: "int"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, locs := testServer(t, map[string]string{"gno.land/r/demo/foo/foo.gno": decl + tt.call + "\n"})
+			fn := locs["fn"]
+			edit, err := s.changeSignature(changeSignatureArgs{URI: fn.URI, Position: fn.Range.Start, Params: tt.specs})
+			if (err == nil) != (tt.want != "") {
+				t.Fatalf("err = %v, want refused: %v", err, tt.want == "")
+			}
+			if err != nil {
+				return
+			}
+			var got strings.Builder
+			for _, e := range edit.Changes[fn.URI] {
+				got.WriteString(e.NewText)
+			}
+			if !strings.Contains(got.String(), tt.want) {
+				t.Errorf("missing %q in:\n%s", tt.want, got.String())
+			}
+		})
+	}
+}
+
+func TestChangeSignatureTests(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/r/demo/foo/gno.mod": "module gno.land/r/demo/foo\n",
+		"gno.land/r/demo/foo/foo.gno": `package foo
+
+func /*fn*/Add(a, b int) int {
+	return a
+}
+`,
+		"gno.land/r/demo/foo/foo_test.gno": `package foo
+
+var x = Add(1, 2)
+`,
+		"gno.land/r/demo/foo/x_test.gno": `package foo_test
+
+import "gno.land/r/demo/foo"
+
+var y = foo.Add(1, 2)
+`,
+		"gno.land/r/demo/foo/z_filetest.gno": `package main
+
+import "gno.land/r/demo/foo"
+
+func main() {
+	println(foo.Add(1, 2))
+}
+`,
+	})
+	fn := locs["fn"]
+	zero := 0
+	edit, err := s.changeSignature(changeSignatureArgs{URI: fn.URI, Position: fn.Range.Start, Params: []paramSpec{{From: &zero}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(fn.URI.Filename())
+	for name, want := range map[string]string{
+		"foo.gno":        "func Add(a int) int {",
+		"foo_test.gno":   "var x = Add(1)",
+		"x_test.gno":     "var y = foo.Add(1)",
+		"z_filetest.gno": "println(foo.Add(1))",
+	} {
+		var got strings.Builder
+		for _, e := range edit.Changes[getURI(filepath.Join(dir, name))] {
+			got.WriteString(e.NewText)
+		}
+		if !strings.Contains(got.String(), want) {
+			t.Errorf("%s: missing %q in:\n%s", name, want, got.String())
+		}
+	}
+}
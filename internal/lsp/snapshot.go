@@ -8,7 +8,9 @@ import (
 	"go/parser"
 	"go/token"
 	"log/slog"
+	"os"
 	"strings"
+	"sync"
 	"unicode/utf8"
 
 	"go.lsp.dev/protocol"
@@ -31,10 +33,25 @@ func (s *Snapshot) Get(filePath string) (*GnoFile, bool) {
 	return s.file.Get(filePath)
 }
 
+// ReadFile returns the content of filePath from the snapshot
+// if the file is opened, from the disk otherwise.
+func (s *Snapshot) ReadFile(filePath string) ([]byte, error) {
+	if f, ok := s.file.Get(filePath); ok {
+		return f.Src, nil
+	}
+	return os.ReadFile(filePath)
+}
+
 // contains gno file.
 type GnoFile struct {
 	URI protocol.DocumentURI
 	Src []byte
+
+	// type-checked package of the file, using Src.
+	// See `server.typeCheckFile`.
+	mu          sync.Mutex // guards checked and checkedFrom
+	checked     *TypeCheckResult
+	checkedFrom *Package
 }
 
 // contains parsed gno file.
@@ -0,0 +1,394 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.lsp.dev/protocol"
+)
+
+// implementInterfaceArgs are the arguments of `gnopls.implementInterface`.
+type implementInterfaceArgs struct {
+	// URI is the file declaring the type.
+	URI protocol.DocumentURI `json:"uri"`
+	// Type is the name of the type.
+	Type string `json:"type"`
+	// Interface is the interface to implement, as `path.Name`. If empty,
+	// the user chooses it among the interfaces the type can implement.
+	Interface string `json:"interface,omitempty"`
+}
+
+// codeActionsStub returns the "Implement interface" code actions of the
+// type declared at the start of rng in file: one per interface of the
+// package, of its imports and of the index that the type implements
+// partially, i.e. it has some of their methods but not all, and one
+// letting the user choose among all of them.
+func (s *server) codeActionsStub(file *GnoFile, rng protocol.Range) []protocol.CodeAction {
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil
+	}
+	f, tf := tcr.file(filepath.Base(file.URI.Filename()))
+	if f == nil {
+		return nil
+	}
+	pos := posFromPosition(tf, rng.Start)
+	if !pos.IsValid() {
+		return nil
+	}
+	id, obj := tcr.identAt(f, pos)
+	tn, ok := obj.(*types.TypeName)
+	if !ok || tcr.info.Defs[id] != tn {
+		return nil
+	}
+	if _, _, ok := stubTarget(tcr, f, tn); !ok {
+		return nil
+	}
+	st, err := s.checkStubType(file, tcr, tn.Name())
+	if err != nil {
+		return nil
+	}
+
+	actions := []protocol.CodeAction{}
+	for _, iface := range stubCandidates(st.pkgs, st.named, true) {
+		edit, err := s.stubEdit(file.URI, st, iface)
+		if err != nil {
+			continue
+		}
+		actions = append(actions, protocol.CodeAction{
+			Title: "Implement " + types.TypeString(iface, types.RelativeTo(st.rf.tcr.pkg)),
+			Kind:  protocol.RefactorRewrite,
+			Edit:  edit,
+		})
+	}
+	action := commandAction("Implement interface...", "gnopls.implementInterface", implementInterfaceArgs{URI: file.URI, Type: tn.Name()})
+	action.Kind = protocol.RefactorRewrite
+	return append(actions, action)
+}
+
+// cmdImplementInterface adds the stubs of the methods of an interface
+// that a type is missing. The user chooses the interface if it isn't
+// given.
+func cmdImplementInterface(ctx context.Context, s *server, args implementInterfaceArgs) (any, error) {
+	file, ok := s.snapshot.Get(args.URI.Filename())
+	if !ok {
+		return nil, errors.New("snapshot not found")
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil, errors.New("cannot type-check the package")
+	}
+	st, err := s.checkStubType(file, tcr, args.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := map[string]*types.Named{}
+	var keys []string
+	for _, iface := range stubCandidates(st.pkgs, st.named, false) {
+		candidates[interfaceKey(iface)] = iface
+		keys = append(keys, interfaceKey(iface))
+	}
+	if args.Interface != "" && candidates[args.Interface] == nil {
+		return nil, fmt.Errorf("%s cannot implement %s", args.Type, args.Interface)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no interface for %s to implement", args.Type)
+	}
+
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		key := args.Interface
+		if key == "" {
+			var err error
+			if key, err = s.chooseInterface(ctx, args.Type, keys); err != nil || key == "" {
+				return
+			}
+		}
+		edit, err := s.stubEdit(file.URI, st, candidates[key])
+		if err == nil {
+			err = s.applyEdit(ctx, "Implement "+key, *edit)
+		}
+		if err != nil {
+			s.showMessage(ctx, protocol.MessageTypeError, err.Error())
+		}
+	}()
+	return nil, nil
+}
+
+// chooseInterface asks the user to choose one of the interfaces keys for
+// the type name to implement, and returns it. It is empty if the user
+// chose none.
+func (s *server) chooseInterface(ctx context.Context, name string, keys []string) (string, error) {
+	actions := make([]protocol.MessageActionItem, len(keys))
+	for i, key := range keys {
+		actions[i] = protocol.MessageActionItem{Title: key}
+	}
+	var chosen *protocol.MessageActionItem
+	_, err := s.conn.Call(ctx, protocol.MethodWindowShowMessageRequest, &protocol.ShowMessageRequestParams{
+		Type:    protocol.MessageTypeInfo,
+		Message: "Interface for " + name + " to implement",
+		Actions: actions,
+	}, &chosen)
+	if err != nil || chosen == nil {
+		return "", err
+	}
+	return chosen.Title, nil
+}
+
+// stubType is a type to add method stubs to, type-checked along with
+// the packages of the interfaces it may implement.
+type stubType struct {
+	rf    *refactoring // of the file declaring the type
+	named *types.Named
+	at    token.Pos          // where to add the stubs
+	pkgs  []*TypeCheckResult // see comparablePackages
+}
+
+// checkStubType type-checks the package of tcr along with the workspace
+// packages, and returns its type name declared in file.
+func (s *server) checkStubType(file *GnoFile, tcr *TypeCheckResult, name string) (*stubType, error) {
+	pkgs := s.comparablePackages(tcr)
+	if len(pkgs) == 0 {
+		return nil, errors.New("cannot type-check the package")
+	}
+	tcr = pkgs[0]
+	f, tf := tcr.file(filepath.Base(file.URI.Filename()))
+	tn, _ := tcr.pkg.Scope().Lookup(name).(*types.TypeName)
+	if f == nil || tn == nil {
+		return nil, fmt.Errorf("type %s not found", name)
+	}
+	named, at, ok := stubTarget(tcr, f, tn)
+	if !ok {
+		return nil, fmt.Errorf("%s cannot implement an interface", name)
+	}
+	return &stubType{
+		rf:    &refactoring{tcr: tcr, f: f, tf: tf, src: file.Src},
+		named: named,
+		at:    at,
+		pkgs:  pkgs,
+	}, nil
+}
+
+// stubTarget returns the named type of tn if stubs can be added to it,
+// along with the position to add them at: after the type and its
+// methods in f.
+func stubTarget(tcr *TypeCheckResult, f *ast.File, tn *types.TypeName) (*types.Named, token.Pos, bool) {
+	if tn.IsAlias() {
+		return nil, token.NoPos, false
+	}
+	named, ok := tn.Type().(*types.Named)
+	if !ok || named.TypeParams() != nil || types.IsInterface(named) {
+		return nil, token.NoPos, false
+	}
+	if _, ok := named.Underlying().(*types.Pointer); ok {
+		return nil, token.NoPos, false
+	}
+	decl := typeDecl(f, tn)
+	if decl == nil {
+		return nil, token.NoPos, false
+	}
+	at := decl.End()
+	for _, d := range f.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if ok && fd.Recv != nil && fd.End() > at && receiverNamed(tcr.info, fd) == named {
+			at = fd.End()
+		}
+	}
+	return named, at, true
+}
+
+// stubEdit returns the edit of the file of st adding the stubs of the
+// methods of iface that its type is missing.
+func (s *server) stubEdit(uri protocol.DocumentURI, st *stubType, iface *types.Named) (*protocol.WorkspaceEdit, error) {
+	fi := newFileImports(st.rf.tcr.pkg, st.rf.f)
+	stubs := methodStubs(st.named, iface, fi.qualifier)
+	if stubs == "" {
+		return nil, errors.New("no method to add")
+	}
+	src, err := fi.addImports(st.rf.splice(replacement{st.at, st.at, "\n\n" + stubs}))
+	if err != nil {
+		return nil, err
+	}
+	return s.formattedEdit(uri, src)
+}
+
+// interfaceKey identifies iface across type-checks.
+func interfaceKey(iface *types.Named) string {
+	return iface.Obj().Pkg().Path() + "." + iface.Obj().Name()
+}
+
+// stubCandidates returns the interfaces t could implement: those of its
+// package, of the packages it imports and of pkgs, starting with its
+// package (see comparablePackages). If partial is set, only those with a
+// method t already has are returned.
+func stubCandidates(pkgs []*TypeCheckResult, t *types.Named, partial bool) []*types.Named {
+	res := []*types.Named{}
+	seen := map[string]bool{} // packages may be checked several times
+	add := func(iface *types.Named) {
+		key := interfaceKey(iface)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		it := iface.Underlying().(*types.Interface)
+		if it.Empty() || !it.IsMethodSet() || implements(t, it) || !implementable(t, it) {
+			return
+		}
+		if partial && !sharesMethod(t, it) {
+			return
+		}
+		res = append(res, iface)
+	}
+	interfaces := func(pkgs []*types.Package) []*types.Named {
+		ifaces := []*types.Named{}
+		for _, named := range namedTypes(pkgs) {
+			if named.TypeParams() == nil && types.IsInterface(named) {
+				ifaces = append(ifaces, named)
+			}
+		}
+		return ifaces
+	}
+
+	all := append([]*types.Package{t.Obj().Pkg()}, t.Obj().Pkg().Imports()...)
+	for _, res := range pkgs {
+		all = append(all, res.pkg)
+	}
+	for _, iface := range interfaces(all) {
+		add(iface)
+	}
+	return res
+}
+
+// implementable reports whether t can implement iface: its unexported
+// methods are of the package of t, and t has no method of the same name
+// with another signature.
+func implementable(t *types.Named, iface *types.Interface) bool {
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		if !m.Exported() && m.Pkg() != t.Obj().Pkg() {
+			return false
+		}
+		obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, m.Pkg(), m.Name())
+		if obj == nil {
+			continue
+		}
+		if fn, ok := obj.(*types.Func); !ok || !types.Identical(fn.Type(), m.Type()) {
+			return false
+		}
+	}
+	return true
+}
+
+// sharesMethod reports whether t has a method of iface.
+func sharesMethod(t *types.Named, iface *types.Interface) bool {
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		if obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, m.Pkg(), m.Name()); obj != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// methodStubs returns the declarations of the methods of iface that t is
+// missing, with packages named by qf.
+func methodStubs(t *types.Named, iface *types.Named, qf types.Qualifier) string {
+	it := iface.Underlying().(*types.Interface)
+	recvName, ptr := receiverOf(t)
+	recv := t.Obj().Name()
+	if ptr {
+		recv = "*" + recv
+	}
+
+	var methods []*types.Func
+	for i := 0; i < it.NumMethods(); i++ {
+		m := it.Method(i)
+		if obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, m.Pkg(), m.Name()); obj == nil {
+			methods = append(methods, m)
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Pos() < methods[j].Pos() })
+
+	var b strings.Builder
+	for i, m := range methods {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		sig := m.Type().(*types.Signature)
+		name := recvName
+		for _, vars := range []*types.Tuple{sig.Params(), sig.Results()} {
+			for j := 0; j < vars.Len(); j++ {
+				if vars.At(j).Name() == name {
+					name = "_"
+				}
+			}
+		}
+		var sb bytes.Buffer
+		types.WriteSignature(&sb, sig, qf)
+		b.WriteString("// " + m.Name() + " implements " + types.TypeString(iface, qf) + ".\n")
+		b.WriteString("func (" + name + " " + recv + ") " + m.Name() + sb.String() + " {\n")
+		b.WriteString("\tpanic(\"not implemented\")\n}")
+	}
+	return b.String()
+}
+
+// receiverOf returns the receiver name of the methods of t, and whether
+// it is a pointer, following its existing methods.
+func receiverOf(t *types.Named) (string, bool) {
+	for i := 0; i < t.NumMethods(); i++ {
+		recv := t.Method(i).Type().(*types.Signature).Recv()
+		if recv == nil || recv.Name() == "" || recv.Name() == "_" {
+			continue
+		}
+		_, ptr := recv.Type().(*types.Pointer)
+		return recv.Name(), ptr
+	}
+	r, _ := utf8.DecodeRuneInString(t.Obj().Name())
+	_, isStruct := t.Underlying().(*types.Struct)
+	return string(unicode.ToLower(r)), isStruct
+}
+
+// receiverNamed returns the named type of the receiver of the method fd.
+func receiverNamed(info *types.Info, fd *ast.FuncDecl) *types.Named {
+	fn, ok := info.Defs[fd.Name].(*types.Func)
+	if !ok {
+		return nil
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return nil
+	}
+	t := recv.Type()
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, _ := t.(*types.Named)
+	return named
+}
+
+// typeDecl returns the declaration of tn in f.
+func typeDecl(f *ast.File, tn *types.TypeName) *ast.GenDecl {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			if spec.(*ast.TypeSpec).Name.Pos() == tn.Pos() {
+				return gen
+			}
+		}
+	}
+	return nil
+}
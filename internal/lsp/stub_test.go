@@ -0,0 +1,195 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"go/types"
+	"strings"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func TestStubCandidates(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/r/demo/foo/gno.mod": "module gno.land/r/demo/foo\n",
+		"gno.land/r/demo/foo/foo.gno": `package foo
+
+import "gno.land/p/demo/bar"
+
+type Closer interface {
+	Close() error
+}
+
+type ReadCloser interface {
+	Read() string
+	Close() error
+}
+
+type Named interface {
+	Name() string
+}
+
+type /*use*/T struct{}
+
+func (T) Read() string { return "" }
+
+var _ = bar.Render
+`,
+		"gno.land/p/demo/bar/gno.mod": "module gno.land/p/demo/bar\n",
+		"gno.land/p/demo/bar/bar.gno": `package bar
+
+type Renderer interface {
+	Render(path string) string
+}
+
+type Reader interface {
+	Read() string
+	Reset()
+}
+
+func Render(r Renderer) string { return r.Render("") }
+`,
+	})
+	file, _ := s.snapshot.Get(locs["use"].URI.Filename())
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		t.Fatal("cannot type-check")
+	}
+	st, err := s.checkStubType(file, tcr, "T")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, iface := range stubCandidates(st.pkgs, st.named, true) {
+		got = append(got, types.TypeString(iface, types.RelativeTo(st.named.Obj().Pkg())))
+	}
+	// Closer, Named and Renderer have no method of T
+	want := "ReadCloser gno.land/p/demo/bar.Reader"
+	if strings.Join(got, " ") != want {
+		t.Errorf("candidates = %v, want %s", got, want)
+	}
+}
+
+func TestMethodStubsReceiverName(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/r/demo/foo/foo.gno": `package foo
+
+type I interface {
+	Get(k string) (t int)
+	Set(t int)
+	Other(v int) int
+}
+
+type /*use*/T struct{}
+`,
+	})
+	file, _ := s.snapshot.Get(locs["use"].URI.Filename())
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		t.Fatal("cannot type-check")
+	}
+	named := tcr.pkg.Scope().Lookup("T").Type().(*types.Named)
+	iface := tcr.pkg.Scope().Lookup("I").Type().(*types.Named)
+
+	got := methodStubs(named, iface, types.RelativeTo(tcr.pkg))
+	for _, want := range []string{
+		"func (_ *T) Get(k string) (t int) {",
+		"func (_ *T) Set(t int) {",
+		"func (t *T) Other(v int) int {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+// clientConn is a client connection choosing the action title in
+// `window/showMessageRequest`, and sending the edits to apply to edits.
+type clientConn struct {
+	nopConn
+	title string
+	edits chan protocol.ApplyWorkspaceEditParams
+}
+
+func (c *clientConn) Call(_ context.Context, method string, params, result interface{}) (jsonrpc2.ID, error) {
+	var res any
+	switch method {
+	case protocol.MethodWindowShowMessageRequest:
+		for _, action := range params.(*protocol.ShowMessageRequestParams).Actions {
+			if action.Title == c.title {
+				res = action
+			}
+		}
+	case protocol.MethodWorkspaceApplyEdit:
+		c.edits <- params.(protocol.ApplyWorkspaceEditParams)
+		res = protocol.ApplyWorkspaceEditResponse{Applied: true}
+	}
+	b, _ := json.Marshal(res)
+	return jsonrpc2.NewNumberID(0), json.Unmarshal(b, result)
+}
+
+func TestImplementInterface(t *testing.T) {
+	s, locs := testServer(t, map[string]string{
+		"gno.land/r/demo/foo/gno.mod": "module gno.land/r/demo/foo\n",
+		"gno.land/r/demo/foo/foo.gno": `package foo
+
+import "gno.land/p/demo/bar"
+
+type /*use*/T struct{}
+
+var _ = bar.Render
+`,
+		"gno.land/p/demo/bar/gno.mod": "module gno.land/p/demo/bar\n",
+		"gno.land/p/demo/bar/bar.gno": `package bar
+
+type Renderer interface {
+	Render(path string) string
+}
+
+func Render(r Renderer) string { return r.Render("") }
+`,
+	})
+	conn := &clientConn{title: "gno.land/p/demo/bar.Renderer", edits: make(chan protocol.ApplyWorkspaceEditParams, 1)}
+	s.conn = conn
+	uri := locs["use"].URI
+
+	// T has no method, it is only offered to choose the interface
+	var actions []protocol.CodeAction
+	err := request(t, s, "textDocument/codeAction", protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        locs["use"].Range,
+	}, &actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cmd *protocol.Command
+	for _, action := range actions {
+		if strings.HasPrefix(action.Title, "Implement") {
+			if action.Command == nil || cmd != nil {
+				t.Fatalf("unexpected action %q", action.Title)
+			}
+			cmd = action.Command
+		}
+	}
+	if cmd == nil {
+		t.Fatal("no action to implement an interface")
+	}
+
+	var res any
+	if err := request(t, s, "workspace/executeCommand", cmd, &res); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case params := <-conn.edits:
+		got := params.Edit.Changes[uri][0].NewText
+		if want := "func (t *T) Render(path string) string {"; !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no edit applied")
+	}
+}
@@ -0,0 +1,283 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/types"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// typeHierarchyData identifies the type of a type hierarchy item.
+type typeHierarchyData struct {
+	// URI is the document the hierarchy was prepared from, packages
+	// are type-checked along with its package.
+	URI  protocol.DocumentURI `json:"u"`
+	Pkg  string               `json:"p"`
+	Name string               `json:"n"`
+}
+
+func (s *server) PrepareTypeHierarchy(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	var params typeHierarchyPrepareParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+
+	uri := params.TextDocument.URI
+	file, ok := s.snapshot.Get(uri.Filename())
+	if !ok {
+		return reply(ctx, nil, errors.New("snapshot not found"))
+	}
+	tcr, f, pos, ok := s.typeCheckPosition(file, params.Position)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	_, obj := tcr.identAt(f, pos)
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	// Aliases are resolved to the type they denote
+	named, ok := tn.Type().(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return reply(ctx, nil, nil)
+	}
+	item, ok := typeHierarchyItemOf(tcr, named, uri)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+	return reply(ctx, []typeHierarchyItem{item}, nil)
+}
+
+func (s *server) Supertypes(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	return s.typeHierarchy(ctx, reply, req, supertypes)
+}
+
+func (s *server) Subtypes(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+	return s.typeHierarchy(ctx, reply, req, subtypes)
+}
+
+// typeHierarchy replies with the items of the types related to the
+// requested item by relatives.
+func (s *server) typeHierarchy(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request, relatives func(*types.Named, []*types.Package) []*types.Named) error {
+	var params typeHierarchyParams
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return sendParseError(ctx, reply, err)
+	}
+	data, tcr, ok := s.typeHierarchyItemData(params.Item)
+	if !ok {
+		return reply(ctx, nil, nil)
+	}
+
+	checked := s.cachedPackages(tcr)
+	if len(checked) == 0 {
+		return reply(ctx, nil, nil)
+	}
+	tcr = checked[0]
+	pkgs := []*types.Package{}
+	var named *types.Named
+	for _, res := range checked {
+		pkgs = append(pkgs, res.pkg)
+		if res.pkg.Path() != data.Pkg {
+			continue
+		}
+		if tn, ok := res.pkg.Scope().Lookup(data.Name).(*types.TypeName); ok {
+			named, _ = tn.Type().(*types.Named)
+		}
+	}
+	if named == nil {
+		return reply(ctx, nil, nil)
+	}
+
+	items := []typeHierarchyItem{}
+	for _, t := range relatives(named, pkgs) {
+		if item, ok := typeHierarchyItemOf(tcr, t, data.URI); ok {
+			items = append(items, item)
+		}
+	}
+	return reply(ctx, items, nil)
+}
+
+// typeHierarchyItemData decodes the data of item, and returns the
+// type-checked package of the document it was prepared from.
+func (s *server) typeHierarchyItemData(item typeHierarchyItem) (*typeHierarchyData, *TypeCheckResult, bool) {
+	b, err := json.Marshal(item.Data)
+	if err != nil {
+		return nil, nil, false
+	}
+	var data typeHierarchyData
+	if err := json.Unmarshal(b, &data); err != nil || data.Name == "" {
+		return nil, nil, false
+	}
+	file, ok := s.snapshot.Get(data.URI.Filename())
+	if !ok {
+		return nil, nil, false
+	}
+	tcr, ok := s.typeCheckFile(file)
+	if !ok {
+		return nil, nil, false
+	}
+	return &data, tcr, true
+}
+
+// supertypes returns the types embedded by t, then the named interfaces
+// of pkgs implemented by t.
+func supertypes(t *types.Named, pkgs []*types.Package) []*types.Named {
+	res := []*types.Named{}
+	seen := map[*types.TypeName]bool{t.Obj(): true}
+	add := func(named *types.Named) {
+		if named != nil && !seen[named.Obj()] {
+			seen[named.Obj()] = true
+			res = append(res, named)
+		}
+	}
+
+	for _, e := range embeddedTypes(t) {
+		add(namedOf(e))
+	}
+	if iface, ok := t.Underlying().(*types.Interface); ok {
+		for _, named := range namedTypes(pkgs) {
+			other, ok := named.Underlying().(*types.Interface)
+			if ok && !other.Empty() && !iface.Empty() && types.Implements(iface, other) {
+				add(named)
+			}
+		}
+		return res
+	}
+	for _, named := range implementingTypes(t, pkgs) {
+		add(named)
+	}
+	return res
+}
+
+// subtypes returns the named types of pkgs embedding t, then the named
+// types implementing t if it is an interface.
+func subtypes(t *types.Named, pkgs []*types.Package) []*types.Named {
+	res := []*types.Named{}
+	seen := map[*types.TypeName]bool{t.Obj(): true}
+	add := func(named *types.Named) {
+		if !seen[named.Obj()] {
+			seen[named.Obj()] = true
+			res = append(res, named)
+		}
+	}
+
+	all := namedTypes(pkgs)
+	for _, named := range all {
+		for _, e := range embeddedTypes(named) {
+			if other := namedOf(e); other != nil && types.Identical(other, t) {
+				add(named)
+			}
+		}
+	}
+	iface, ok := t.Underlying().(*types.Interface)
+	if !ok || iface.Empty() {
+		return res
+	}
+	for _, named := range all {
+		if other, ok := named.Underlying().(*types.Interface); ok {
+			if types.Implements(other, iface) {
+				add(named)
+			}
+			continue
+		}
+		if implements(named, iface) {
+			add(named)
+		}
+	}
+	return res
+}
+
+// embeddedTypes returns the embedded fields of the struct t, or the
+// embedded types of the interface t.
+func embeddedTypes(t types.Type) []types.Type {
+	var res []types.Type
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if f := u.Field(i); f.Embedded() {
+				res = append(res, f.Type())
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < u.NumEmbeddeds(); i++ {
+			res = append(res, u.EmbeddedType(i))
+		}
+	}
+	return res
+}
+
+// namedTypes returns the package-level named types of pkgs.
+func namedTypes(pkgs []*types.Package) []*types.Named {
+	res := []*types.Named{}
+	for _, pkg := range pkgs {
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			if named, ok := tn.Type().(*types.Named); ok {
+				res = append(res, named)
+			}
+		}
+	}
+	return res
+}
+
+// typeHierarchyItemOf returns the item of the type t, declared in tcr or
+// in one of the packages it imports.
+func typeHierarchyItemOf(tcr *TypeCheckResult, t *types.Named, uri protocol.DocumentURI) (typeHierarchyItem, bool) {
+	tn := t.Obj()
+	owner, ok := tcr.owner(tn)
+	if !ok {
+		return typeHierarchyItem{}, false
+	}
+	spec := typeSpec(owner, tn)
+	if spec == nil {
+		return typeHierarchyItem{}, false
+	}
+
+	kind := protocol.SymbolKindClass
+	switch t.Underlying().(type) {
+	case *types.Struct:
+		kind = protocol.SymbolKindStruct
+	case *types.Interface:
+		kind = protocol.SymbolKindInterface
+	}
+	loc := owner.location(spec.Pos(), spec.End())
+	return typeHierarchyItem{
+		Name:           tn.Name(),
+		Kind:           kind,
+		Detail:         tn.Pkg().Path(),
+		URI:            loc.URI,
+		Range:          loc.Range,
+		SelectionRange: owner.location(spec.Name.Pos(), spec.Name.End()).Range,
+		Data: typeHierarchyData{
+			URI:  uri,
+			Pkg:  tn.Pkg().Path(),
+			Name: tn.Name(),
+		},
+	}, true
+}
+
+// typeSpec returns the declaration of the type tn in res.
+func typeSpec(res *TypeCheckResult, tn *types.TypeName) *ast.TypeSpec {
+	for _, file := range res.files {
+		for _, d := range file.Decls {
+			decl, ok := d.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				if spec, ok := spec.(*ast.TypeSpec); ok && res.info.Defs[spec.Name] == tn {
+					return spec
+				}
+			}
+		}
+	}
+	return nil
+}
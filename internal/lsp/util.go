@@ -2,6 +2,8 @@ package lsp
 
 import (
 	"fmt"
+	"go/ast"
+	"go/token"
 	"io"
 	"io/fs"
 	"os"
@@ -59,6 +61,31 @@ func ListGnoFiles(path string) ([]string, error) {
 	return files, nil
 }
 
+// filterGnoFiles returns the files of fnames matching keep.
+func filterGnoFiles(fnames []string, keep func(fname string) bool) []string {
+	res := []string{}
+	for _, fname := range fnames {
+		if keep(fname) {
+			res = append(res, fname)
+		}
+	}
+	return res
+}
+
+// isPackageFile reports whether fname is a file of the package
+// itself, i.e. neither a test nor a filetest.
+func isPackageFile(fname string) bool {
+	return !isTestFile(fname) && !isFiletest(fname)
+}
+
+func isTestFile(fname string) bool {
+	return strings.HasSuffix(fname, "_test.gno")
+}
+
+func isFiletest(fname string) bool {
+	return strings.HasSuffix(fname, "_filetest.gno")
+}
+
 // GoToGnoFileName return gno file name from generated go file
 // If not a generated go file, return unchanged fname
 func GoToGnoFileName(fname string) string {
@@ -169,3 +196,19 @@ func symbolToKind(symbol string) protocol.CompletionItemKind {
 		return protocol.CompletionItemKindValue
 	}
 }
+
+// nodeToRange returns the range of n in fset.
+func nodeToRange(fset *token.FileSet, n ast.Node) protocol.Range {
+	start := fset.Position(n.Pos())
+	end := fset.Position(n.End())
+	return protocol.Range{
+		Start: protocol.Position{
+			Line:      uint32(start.Line - 1),
+			Character: uint32(start.Column - 1),
+		},
+		End: protocol.Position{
+			Line:      uint32(end.Line - 1),
+			Character: uint32(end.Column - 1),
+		},
+	}
+}
@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"path/filepath"
+)
+
+// Test a Gno package: gno test -v [-run <run>] <dir>.
+// Output is written to w as the tests run.
+func Test(ctx context.Context, rootDir, run string, w io.Writer) error {
+	args := []string{"test", "-v"}
+	if run != "" {
+		args = append(args, "-run", run)
+	}
+	args = append(args, filepath.Join(rootDir))
+	cmd := exec.CommandContext(ctx, "gno", args...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return cmd.Run()
+}
+
+// UpdateGoldenTests runs the filetests of a Gno package, rewriting their
+// expected results: gno test -update-golden-tests [-run <run>] <dir>.
+// It returns the combined output.
+func UpdateGoldenTests(ctx context.Context, rootDir, run string) ([]byte, error) {
+	args := []string{"test", "-update-golden-tests"}
+	if run != "" {
+		args = append(args, "-run", run)
+	}
+	args = append(args, filepath.Join(rootDir))
+	cmd := exec.CommandContext(ctx, "gno", args...)
+	return cmd.CombinedOutput()
+}